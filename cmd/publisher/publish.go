@@ -1,25 +1,28 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/nats-io/stan.go"
 )
 
 func main() {
-	sc, err := stan.Connect("my-cluster", "test-publisher")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer sc.Close()
+	target := flag.String("target", "stan", "broker to publish to: stan or jetstream")
+	url := flag.String("url", nats.DefaultURL, "NATS URL for jetstream")
+	status := flag.String("status", "", "publish a status event (e.g. paid) to order-status instead of the order")
+	flag.Parse()
 
 	order := map[string]interface{}{
-		"order_uid":          "RWBLABS",
-		"track_number":       "TESTTRACK",
-		"entry":              "WB",
+		"order_uid":    "RWBLABS",
+		"track_number": "TESTTRACK",
+		"entry":        "WB",
 		"delivery": map[string]interface{}{
 			"name":    "Wild Berry",
 			"phone":   "+78005553535",
@@ -66,13 +69,58 @@ func main() {
 		"oof_shard":          "1",
 	}
 
+	channel := "orders"
 	data, _ := json.Marshal(order)
-	
-	err = sc.Publish("orders", data)
+	if *status != "" {
+		channel = "order-status"
+		data, _ = json.Marshal(map[string]interface{}{
+			"order_uid":  order["order_uid"],
+			"status":     *status,
+			"changed_at": time.Now().Format(time.RFC3339),
+		})
+	}
+
+	var err error
+	switch *target {
+	case "stan":
+		err = publishStan(channel, data)
+	case "jetstream":
+		err = publishJetStream(*url, channel, data)
+	default:
+		err = fmt.Errorf("unknown target %q", *target)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	fmt.Println("Test message sent successfully!")
 	fmt.Println("Order UID: test-order-123")
-}
\ No newline at end of file
+}
+
+func publishStan(channel string, data []byte) error {
+	sc, err := stan.Connect("my-cluster", "test-publisher")
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+
+	return sc.Publish(channel, data)
+}
+
+func publishJetStream(url, channel string, data []byte) error {
+	nc, err := nats.Connect(url)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = js.Publish(ctx, channel, data)
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-service/internal/handlers"
+	"order-service/internal/source"
+)
+
+func (app *App) healthChecks() []handlers.Check {
+	checks := []handlers.Check{
+		{Name: "postgres", Run: app.db.PingContext},
+	}
+	for _, src := range app.sources {
+		checks = append(checks, handlers.Check{Name: src.Name(), Run: checkSource(src)})
+	}
+	if app.statuses != nil {
+		checks = append(checks, handlers.Check{Name: app.statuses.Name(), Run: checkSource(app.statuses)})
+	}
+	if app.coherence != nil {
+		checks = append(checks, handlers.Check{Name: "cache_coherence", Run: func(ctx context.Context) error {
+			return app.coherence.Ping()
+		}})
+	}
+	return append(checks, handlers.Check{Name: "cache_restore", Run: app.checkRestore})
+}
+
+func checkSource(src source.MessageSource) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if state := src.State(); state != source.StateConnected {
+			return fmt.Errorf("connection %s", state)
+		}
+		return nil
+	}
+}
+
+func (app *App) checkRestore(ctx context.Context) error {
+	if !app.restored.Load() {
+		return errors.New("cache restore in progress")
+	}
+	return nil
+}
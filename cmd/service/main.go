@@ -1,17 +1,34 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"order-service/internal/cache"
+	"order-service/internal/coherence"
 	"order-service/internal/config"
+	"order-service/internal/consistency"
 	"order-service/internal/handlers"
+	"order-service/internal/ingest"
+	"order-service/internal/metrics"
+	"order-service/internal/models"
+	"order-service/internal/outbox"
 	"order-service/internal/service"
+	"order-service/internal/source"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
-	"github.com/nats-io/stan.go"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type App struct {
@@ -20,43 +37,144 @@ type App struct {
 	cache    *cache.Cache
 	service  service.OrderService
 	handlers *handlers.Handler
-	stanConn stan.Conn
+	sources  []source.MessageSource
+	consumer *ingest.Consumer
+	// statuses is the status channel source, nil when disabled.
+	statuses       source.MessageSource
+	statusConsumer *ingest.Consumer
+	relay          *outbox.Relay
+	coherence      *coherence.Listener
+	snapshots      *snapshotter
+	server         *http.Server
+	restored       atomic.Bool
 }
 
 func main() {
 	cfg := config.Load()
-	
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	app := &App{
 		config: cfg,
-		cache:  cache.New(),
+		cache: cache.NewWithOptions(cache.Options{
+			MaxEntries: cfg.CacheMaxEntries,
+			MaxBytes:   int64(cfg.CacheMaxBytes),
+			TTL:        cfg.CacheTTL,
+		}),
+	}
+
+	if err := metrics.RegisterCache(prometheus.DefaultRegisterer, app.cache); err != nil {
+		log.Fatal("Failed to register cache metrics:", err)
 	}
 
 	if err := app.initDB(); err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
-	defer app.db.Close()
 
-	if err := app.restoreCache(); err != nil {
-		log.Fatal("Failed to restore cache:", err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := app.runMigrate(os.Args[2:])
+		app.db.Close()
+		if err != nil {
+			log.Fatal("Migration failed:", err)
+		}
+		return
+	}
+
+	if cfg.DBAutoMigrate {
+		if err := app.migrateUp(); err != nil {
+			log.Fatal("Failed to migrate database:", err)
+		}
+	}
+
+	if err := app.initSources(); err != nil {
+		log.Fatal("Failed to initialize message sources:", err)
+	}
+
+	rules, err := consistency.ParseActions(cfg.ConsistencyRules)
+	if err != nil {
+		log.Fatal("Invalid consistency rules:", err)
 	}
 
-	if err := app.initNATS(); err != nil {
-		log.Fatal("Failed to initialize NATS:", err)
+	app.service = service.New(app.db, app.cache,
+		service.WithDeadLetterPublisher(app.sources[0], cfg.NATSDeadLetter),
+		service.WithConsistencyRules(consistency.New(rules)),
+		service.WithRestoreOptions(service.RestoreOptions{
+			MaxAge:       cfg.RestoreMaxAge,
+			Limit:        cfg.RestoreLimit,
+			BatchSize:    cfg.RestoreBatch,
+			SnapshotPath: cfg.CacheSnapshotPath,
+		}))
+	if cfg.CacheCoherence {
+		app.coherence = coherence.New(app.connString(), app.cache, cfg.NATSReconnectMin, cfg.NATSReconnectMax)
+	}
+	app.handlers = handlers.New(app.service, app.healthChecks()...)
+	// Sources never hold more than NATSMaxInflight unacked messages, so
+	// queues of that size keep the delivering goroutine from blocking.
+	app.consumer = ingest.New(app.service,
+		ingest.WithWorkers(cfg.IngestWorkers, cfg.NATSMaxInflight),
+		ingest.WithBatches(cfg.IngestBatchSize, cfg.IngestBatchWindow))
+	app.statusConsumer = ingest.New(app.service,
+		ingest.WithWorkers(cfg.IngestWorkers, cfg.NATSMaxInflight),
+		ingest.WithProcessor(app.service.ProcessStatusEvent))
+	if publisher := app.eventPublisher(); publisher != nil {
+		app.relay = outbox.New(app.db, publisher,
+			outbox.WithInterval(cfg.OutboxInterval),
+			outbox.WithBatchSize(cfg.OutboxBatchSize))
+		app.relay.Start()
+	} else {
+		log.Println("Order events stay in the outbox: publishing them needs jetstream or stan in INGEST_SOURCES")
 	}
-	defer app.stanConn.Close()
 
-	app.service = service.New(app.db, app.cache, app.stanConn)
-	app.handlers = handlers.New(app.service)
-	
+	// HTTP comes up first so that probes can observe the restore; the
+	// subscription waits for it so that messages land in a warm cache.
 	app.startHTTPServer()
+
+	// Listening starts before the restore: an order changed while it runs
+	// is invalidated, and the restore then skips the version it read.
+	if app.coherence != nil {
+		if err := app.coherence.Start(); err != nil {
+			log.Fatal("Failed to start cache coherence:", err)
+		}
+	}
+
+	if err := app.service.RestoreCache(ctx); err != nil {
+		if ctx.Err() == nil {
+			log.Fatal("Failed to restore cache:", err)
+		}
+		log.Println("Shutdown signal received during cache restore")
+		if err := app.shutdown(cfg.ShutdownTimeout); err != nil {
+			log.Fatal("Shutdown failed:", err)
+		}
+		return
+	}
+	app.restored.Store(true)
+	if cfg.CacheSnapshotPath != "" {
+		app.snapshots = startSnapshots(app.service, cfg.CacheSnapshotInterval)
+	}
+
+	if err := app.subscribe(); err != nil {
+		log.Fatal("Failed to subscribe to message sources:", err)
+	}
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutdown signal received")
+
+	if err := app.shutdown(cfg.ShutdownTimeout); err != nil {
+		log.Fatal("Shutdown failed:", err)
+	}
+	log.Println("Shutdown completed")
 }
 
-func (app *App) initDB() error {
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		app.config.DBHost, app.config.DBPort, app.config.DBUser, 
+func (app *App) connString() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		app.config.DBHost, app.config.DBPort, app.config.DBUser,
 		app.config.DBPassword, app.config.DBName)
+}
 
-	db, err := sql.Open("postgres", connStr)
+func (app *App) initDB() error {
+	db, err := sql.Open("postgres", app.connString())
 	if err != nil {
 		return err
 	}
@@ -70,48 +188,195 @@ func (app *App) initDB() error {
 	return nil
 }
 
-func (app *App) initNATS() error {
-	sc, err := stan.Connect(app.config.NATSClusterID, app.config.NATSClientID)
-	if err != nil {
-		return err
+func (app *App) initSources() error {
+	cfg := app.config
+	for _, name := range strings.Split(cfg.IngestSources, ",") {
+		var src source.MessageSource
+		switch name = strings.TrimSpace(name); name {
+		case "stan":
+			src = source.NewStan(source.StanConfig{
+				ClusterID:    cfg.NATSClusterID,
+				ClientID:     cfg.NATSClientID,
+				Channel:      cfg.NATSChannel,
+				DurableName:  cfg.NATSDurableID,
+				QueueGroup:   cfg.NATSQueueGroup,
+				AckWait:      cfg.NATSAckWait,
+				MaxInflight:  cfg.NATSMaxInflight,
+				ReconnectMin: cfg.NATSReconnectMin,
+				ReconnectMax: cfg.NATSReconnectMax,
+			})
+		case "jetstream":
+			src = source.NewJetStream(app.jetStreamConfig())
+		case "kafka":
+			src = source.NewKafka(source.KafkaConfig{
+				Brokers:     strings.Split(cfg.KafkaBrokers, ","),
+				Topic:       cfg.KafkaTopic,
+				GroupID:     cfg.KafkaGroupID,
+				MaxInflight: cfg.NATSMaxInflight,
+				RetryMin:    cfg.NATSReconnectMin,
+				RetryMax:    cfg.NATSReconnectMax,
+			})
+		default:
+			return fmt.Errorf("unknown ingest source %q", name)
+		}
+
+		if err := src.Connect(); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		app.sources = append(app.sources, src)
+		log.Printf("Connected to %s successfully", name)
+	}
+
+	if len(app.sources) == 0 {
+		return errors.New("no ingest sources configured")
+	}
+	return app.initStatusSource()
+}
+
+// jetStreamConfig configures the order consumer of the JetStream stream,
+// which also stores the events and the order statuses.
+func (app *App) jetStreamConfig() source.JetStreamConfig {
+	cfg := app.config
+	extra := []string{models.EventOrderCreated, models.EventOrderUpdated}
+	if cfg.NATSStatusChannel != "" {
+		extra = append(extra, cfg.NATSStatusChannel)
 	}
+	return source.JetStreamConfig{
+		URL:               cfg.NATSURL,
+		Name:              cfg.NATSClientID,
+		Stream:            cfg.JetStreamStream,
+		Subject:           cfg.NATSChannel,
+		DeadLetterSubject: cfg.NATSDeadLetter,
+		ExtraSubjects:     extra,
+		Durable:           cfg.NATSDurableID,
+		AckWait:           cfg.NATSAckWait,
+		MaxDeliver:        cfg.JetStreamMaxDeliver,
+		MaxAckPending:     cfg.NATSMaxInflight,
+		ReconnectWait:     cfg.NATSReconnectMin,
+		RetryMin:          cfg.NATSReconnectMin,
+		RetryMax:          cfg.NATSReconnectMax,
+	}
+}
 
-	app.stanConn = sc
+// initStatusSource connects a second client to the status channel, on
+// JetStream when it is configured and on NATS Streaming otherwise. Kafka
+// carries no status events.
+func (app *App) initStatusSource() error {
+	cfg := app.config
+	if cfg.NATSStatusChannel == "" {
+		return nil
+	}
 
-	_, err = sc.Subscribe(app.config.NATSChannel, func(msg *stan.Msg) {
-		if err := app.service.ProcessMessage(msg.Data); err != nil {
-			log.Printf("Error processing message: %v", err)
+	var src source.MessageSource
+	switch {
+	case app.hasSource("jetstream"):
+		jsCfg := app.jetStreamConfig()
+		jsCfg.Source = "jetstream-status"
+		jsCfg.Name += "-status"
+		jsCfg.FilterSubject = cfg.NATSStatusChannel
+		jsCfg.Durable += "-status"
+		src = source.NewJetStream(jsCfg)
+	case app.hasSource("stan"):
+		// A client ID can hold only one connection, hence the suffix.
+		queue := cfg.NATSQueueGroup
+		if queue != "" {
+			queue += "-status"
 		}
-	}, stan.DurableName(app.config.NATSDurableID), stan.SetManualAckMode())
+		src = source.NewStan(source.StanConfig{
+			Name:         "stan-status",
+			ClusterID:    cfg.NATSClusterID,
+			ClientID:     cfg.NATSClientID + "-status",
+			Channel:      cfg.NATSStatusChannel,
+			DurableName:  cfg.NATSDurableID + "-status",
+			QueueGroup:   queue,
+			AckWait:      cfg.NATSAckWait,
+			MaxInflight:  cfg.NATSMaxInflight,
+			MaxDeliver:   cfg.NATSStatusMaxDeliver,
+			ReconnectMin: cfg.NATSReconnectMin,
+			ReconnectMax: cfg.NATSReconnectMax,
+		})
+	default:
+		log.Printf("Status channel %s is not consumed: status events need stan or jetstream in INGEST_SOURCES", cfg.NATSStatusChannel)
+		return nil
+	}
 
-	if err != nil {
-		return err
+	if err := src.Connect(); err != nil {
+		return fmt.Errorf("%s: %v", src.Name(), err)
 	}
+	app.statuses = src
+	log.Printf("Connected to %s successfully", src.Name())
+	return nil
+}
 
-	log.Println("Subscribed to NATS channel successfully")
+// eventPublisher is the NATS source the outbox relay publishes to, JetStream
+// before NATS Streaming; nil when only Kafka is configured.
+func (app *App) eventPublisher() source.MessageSource {
+	for _, name := range []string{"jetstream", "stan"} {
+		if i := slices.IndexFunc(app.sources, func(src source.MessageSource) bool {
+			return src.Name() == name
+		}); i >= 0 {
+			return app.sources[i]
+		}
+	}
 	return nil
 }
 
-func (app *App) restoreCache() error {
-	tempService := service.New(app.db, app.cache, nil)
-	return tempService.RestoreCache()
+func (app *App) hasSource(name string) bool {
+	return slices.ContainsFunc(app.sources, func(src source.MessageSource) bool {
+		return src.Name() == name
+	})
+}
+
+func (app *App) subscribe() error {
+	for _, src := range app.sources {
+		if err := src.Start(app.consumer.Handle); err != nil {
+			return fmt.Errorf("%s: %v", src.Name(), err)
+		}
+		log.Printf("Subscribed to %s successfully", src.Name())
+	}
+
+	if app.statuses != nil {
+		if err := app.statuses.Start(app.statusConsumer.Handle); err != nil {
+			return fmt.Errorf("%s: %v", app.statuses.Name(), err)
+		}
+		log.Printf("Subscribed to %s successfully", app.statuses.Name())
+	}
+	return nil
 }
 
 func (app *App) startHTTPServer() {
 	gin.SetMode(gin.ReleaseMode)
-	
+
 	router := gin.New()
-	router.Use(gin.Recovery())
+	router.Use(gin.Recovery(), handlers.Metrics())
 	router.SetTrustedProxies(nil)
 
 	router.Static("/static", "./static")
 	router.LoadHTMLGlob("templates/*")
 
 	router.GET("/api/order/:id", app.handlers.GetOrder)
+	router.GET("/api/order/:id/history", app.handlers.GetOrderHistory)
+	router.GET("/api/order/:id/status", app.handlers.GetOrderStatus)
+	router.GET("/api/orders", app.handlers.ListOrders)
+	router.GET("/api/orders/by-track/:track", app.handlers.GetOrdersByTrackNumber)
+	router.GET("/api/orders/by-transaction/:transaction", app.handlers.GetOrderByTransaction)
+	router.GET("/api/orders/by-rid/:rid", app.handlers.GetOrderByRid)
 	router.GET("/api/health", app.handlers.HealthCheck)
+	router.GET("/api/health/live", app.handlers.Live)
+	router.GET("/api/health/ready", app.handlers.Ready)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	router.GET("/", app.handlers.WebInterface)
 
-	log.Printf("HTTP server starting on :%s", app.config.HTTPPort)
-	log.Fatal(router.Run(":" + app.config.HTTPPort))
-}
\ No newline at end of file
+	app.server = &http.Server{
+		Addr:    ":" + app.config.HTTPPort,
+		Handler: router,
+	}
+
+	go func() {
+		log.Printf("HTTP server starting on :%s", app.config.HTTPPort)
+		if err := app.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("HTTP server failed:", err)
+		}
+	}()
+}
@@ -1,15 +1,123 @@
 package main
 
 import (
-	"testing"
-	"order-service/internal/config"
+	"context"
 	"github.com/stretchr/testify/assert"
+	"order-service/internal/cache"
+	"order-service/internal/config"
+	"order-service/internal/ingest"
+	"order-service/internal/models"
+	"order-service/internal/service"
+	"order-service/internal/source"
+	"path/filepath"
+	"testing"
+	"time"
 )
 
 func TestAppInitialization(t *testing.T) {
 	cfg := config.Load()
-	
+
 	assert.NotNil(t, cfg)
 	assert.Equal(t, "localhost", cfg.DBHost)
 	assert.Equal(t, 5433, cfg.DBPort)
 }
+
+func TestNATSAckDefaults(t *testing.T) {
+	cfg := config.Load()
+
+	assert.Equal(t, 30*time.Second, cfg.NATSAckWait)
+	assert.Equal(t, 32, cfg.NATSMaxInflight)
+}
+
+func TestIngestSourceDefaults(t *testing.T) {
+	cfg := config.Load()
+
+	assert.Equal(t, "stan", cfg.IngestSources)
+	assert.Equal(t, "ORDERS", cfg.JetStreamStream)
+	assert.Equal(t, 5, cfg.JetStreamMaxDeliver)
+	assert.Equal(t, "order-status", cfg.NATSStatusChannel)
+}
+
+func TestNATSClientIDPerReplica(t *testing.T) {
+	t.Setenv("POD_NAME", "order-service-7d9f8.b2x")
+	cfg := config.Load()
+	assert.Equal(t, "order-service", cfg.NATSClientID)
+	assert.Empty(t, cfg.NATSQueueGroup)
+
+	t.Setenv("NATS_QUEUE_GROUP", "order-service")
+	cfg = config.Load()
+	assert.Equal(t, "order-service-7d9f8-b2x", cfg.NATSClientID)
+	assert.Equal(t, "order-service", cfg.NATSQueueGroup)
+
+	t.Setenv("NATS_CLIENT_ID", "fixed")
+	assert.Equal(t, "fixed", config.Load().NATSClientID)
+}
+
+func TestInitSourcesRejectsUnknown(t *testing.T) {
+	app := &App{config: &config.Config{IngestSources: "amqp"}}
+
+	assert.Error(t, app.initSources())
+	assert.Empty(t, app.sources)
+}
+
+func TestShutdownClosesSources(t *testing.T) {
+	src := source.NewMemory("memory")
+	assert.NoError(t, src.Connect())
+
+	statuses := source.NewMemory("statuses")
+	assert.NoError(t, statuses.Connect())
+
+	app := &App{
+		sources:        []source.MessageSource{src},
+		consumer:       ingest.New(nil),
+		statuses:       statuses,
+		statusConsumer: ingest.New(nil),
+	}
+	assert.NoError(t, app.shutdown(time.Second))
+	assert.Equal(t, source.StateClosed, src.State())
+	assert.Equal(t, source.StateClosed, statuses.State())
+}
+
+func TestShutdownAcksDrainedMessages(t *testing.T) {
+	src := source.NewMemory("memory")
+	assert.NoError(t, src.Connect())
+
+	release := make(chan struct{})
+	consumer := ingest.New(nil, ingest.WithWorkers(1, 1), ingest.WithProcessor(func(service.Message) error {
+		<-release
+		return nil
+	}))
+	assert.NoError(t, src.Start(consumer.Handle))
+	seq, err := src.Deliver("orders", []byte(`{"order_uid":"test-123"}`))
+	assert.NoError(t, err)
+
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+	app := &App{sources: []source.MessageSource{src}, consumer: consumer}
+	assert.NoError(t, app.shutdown(time.Second))
+	assert.Equal(t, []uint64{seq}, src.Acked())
+}
+
+func TestShutdownSavesSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	c := cache.New()
+	c.Set("test-123", &models.Order{OrderUID: "test-123"})
+	svc := service.New(nil, c, service.WithRestoreOptions(service.RestoreOptions{SnapshotPath: path}))
+
+	app := &App{snapshots: startSnapshots(svc, time.Hour)}
+	assert.NoError(t, app.shutdown(time.Second))
+
+	snap, err := cache.LoadSnapshot(path)
+	assert.NoError(t, err)
+	assert.Len(t, snap.Orders, 1)
+}
+
+func TestReadinessChecks(t *testing.T) {
+	app := &App{}
+
+	src := source.NewJetStream(source.JetStreamConfig{})
+	assert.Error(t, checkSource(src)(context.Background()))
+	assert.Error(t, app.checkRestore(context.Background()))
+
+	app.restored.Store(true)
+	assert.NoError(t, app.checkRestore(context.Background()))
+}
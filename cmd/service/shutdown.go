@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-service/internal/ingest"
+	"slices"
+	"time"
+)
+
+// shutdown stops HTTP traffic, waits for in-flight messages, closes the
+// subscriptions while keeping the durables, saves the cache snapshot, stops
+// the outbox relay and closes the connections, all within timeout.
+func (app *App) shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+
+	if app.server != nil {
+		if err := app.server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("http server: %v", err))
+		}
+	}
+
+	sources := app.sources
+	if app.statuses != nil {
+		sources = append(slices.Clip(sources), app.statuses)
+	}
+
+	// Draining refuses new deliveries and waits for the in-flight ones,
+	// which must be acked while the subscriptions are still open: a closed
+	// stan subscription rejects acks and the messages would be redelivered.
+	for _, consumer := range []*ingest.Consumer{app.consumer, app.statusConsumer} {
+		if consumer == nil {
+			continue
+		}
+		if err := consumer.Drain(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, src := range sources {
+		if err := src.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("%s subscription: %v", src.Name(), err))
+		}
+	}
+
+	// The last snapshot includes the drained messages.
+	if app.snapshots != nil {
+		if err := app.snapshots.stop(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Events of the drained messages are relayed before the connections
+	// close; whatever is left is published after the next start.
+	if app.relay != nil {
+		app.relay.Stop()
+	}
+
+	for _, src := range sources {
+		if err := src.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s connection: %v", src.Name(), err))
+		}
+	}
+
+	if app.coherence != nil {
+		if err := app.coherence.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("cache coherence: %v", err))
+		}
+	}
+
+	if app.db != nil {
+		if err := app.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("database: %v", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
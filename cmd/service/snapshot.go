@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"order-service/internal/service"
+	"time"
+)
+
+// snapshotter saves the cache snapshot periodically so that a restart,
+// even an unclean one, only reloads the orders written since then.
+type snapshotter struct {
+	service service.OrderService
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+func startSnapshots(svc service.OrderService, interval time.Duration) *snapshotter {
+	s := &snapshotter{
+		service: svc,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run(interval)
+	return s
+}
+
+func (s *snapshotter) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			if err := s.service.SaveSnapshot(); err != nil {
+				log.Printf("Error saving cache snapshot: %v", err)
+			}
+		}
+	}
+}
+
+// stop waits for a running save and saves a final snapshot.
+func (s *snapshotter) stop() error {
+	close(s.quit)
+	<-s.done
+	return s.service.SaveSnapshot()
+}
@@ -1,53 +1,341 @@
 package cache
 
 import (
-	"sync"
+	"container/list"
 	"order-service/internal/models"
+	"sync"
+	"time"
 )
 
+// Options bound the cache. Zero values mean no limit.
+type Options struct {
+	MaxEntries int
+	MaxBytes   int64
+	TTL        time.Duration
+}
+
+type Stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	// RefusedLoads counts orders read from the database that were not
+	// cached because they were invalidated while being read.
+	RefusedLoads uint64 `json:"refused_loads"`
+	Entries      int    `json:"entries"`
+	Bytes        int64  `json:"bytes"`
+}
+
+type entry struct {
+	key       string
+	order     *models.Order
+	size      int64
+	expiresAt time.Time
+}
+
+// Cache is an LRU cache of orders. The most recently used entries sit at the
+// front of lru; eviction takes from the back. Secondary indexes map payment
+// transactions and item rids to order UIDs and are kept in step with data.
 type Cache struct {
-	sync.RWMutex
-	data map[string]*models.Order
+	sync.Mutex
+	opts  Options
+	data  map[string]*list.Element
+	lru   *list.List
+	bytes int64
+	stats Stats
+	now   func() time.Time
+
+	byTransaction map[string]string
+	byRid         map[string]string
+
+	// Invalidations are numbered by generation. invalidated holds the last
+	// one per order and floor the last Clear. loads counts the loads in
+	// progress per generation they started at; invalidations no load
+	// started before are pruned once there are more than pruneAt.
+	generation  uint64
+	invalidated map[string]uint64
+	floor       uint64
+	loads       map[uint64]int
+	pruneAt     int
 }
 
+// minPruneAt is the number of invalidation records kept before pruning.
+const minPruneAt = 10000
+
 func New() *Cache {
+	return NewWithOptions(Options{})
+}
+
+func NewWithOptions(opts Options) *Cache {
 	return &Cache{
-		data: make(map[string]*models.Order),
+		opts: opts,
+		data: make(map[string]*list.Element),
+		lru:  list.New(),
+		now:  time.Now,
+
+		byTransaction: make(map[string]string),
+		byRid:         make(map[string]string),
+
+		invalidated: make(map[string]uint64),
+		loads:       make(map[uint64]int),
+		pruneAt:     minPruneAt,
 	}
 }
 
 func (c *Cache) Set(orderUID string, order *models.Order) {
 	c.Lock()
 	defer c.Unlock()
-	c.data[orderUID] = order
+	c.set(orderUID, order)
+}
+
+// StartLoad is called before reading orders from the database; the
+// generation it returns is passed to SetLoaded and then to EndLoad.
+func (c *Cache) StartLoad() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	c.loads[c.generation]++
+	return c.generation
+}
+
+// EndLoad ends a load started with StartLoad.
+func (c *Cache) EndLoad(generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if c.loads[generation]--; c.loads[generation] <= 0 {
+		delete(c.loads, generation)
+	}
+}
+
+// SetLoaded caches an order read from the database unless it was
+// invalidated after generation, when the read may predate the change, or a
+// later message of the same stream is cached meanwhile. It reports whether
+// the order was cached.
+func (c *Cache) SetLoaded(orderUID string, order *models.Order, generation uint64) bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.floor > generation || c.invalidated[orderUID] > generation {
+		c.stats.RefusedLoads++
+		return false
+	}
+	if el, exists := c.data[orderUID]; exists {
+		cached := el.Value.(*entry).order
+		if cached.SourceStream == order.SourceStream && cached.SourceSeq > order.SourceSeq {
+			return false
+		}
+	}
+	c.set(orderUID, order)
+	return true
+}
+
+func (c *Cache) set(orderUID string, order *models.Order) {
+	e := &entry{
+		key:   orderUID,
+		order: order,
+		size:  estimateSize(order),
+	}
+	if c.opts.TTL > 0 {
+		e.expiresAt = c.now().Add(c.opts.TTL)
+	}
+
+	if el, exists := c.data[orderUID]; exists {
+		old := el.Value.(*entry)
+		c.unindex(old)
+		c.bytes -= old.size
+		el.Value = e
+		c.lru.MoveToFront(el)
+	} else {
+		c.data[orderUID] = c.lru.PushFront(e)
+	}
+	c.bytes += e.size
+	c.index(e)
+
+	c.evict()
 }
 
 func (c *Cache) Get(orderUID string) (*models.Order, bool) {
-	c.RLock()
-	defer c.RUnlock()
-	order, exists := c.data[orderUID]
-	return order, exists
+	c.Lock()
+	defer c.Unlock()
+	return c.get(orderUID)
+}
+
+func (c *Cache) GetByTransaction(transaction string) (*models.Order, bool) {
+	c.Lock()
+	defer c.Unlock()
+	return c.get(c.byTransaction[transaction])
+}
+
+func (c *Cache) GetByRid(rid string) (*models.Order, bool) {
+	c.Lock()
+	defer c.Unlock()
+	return c.get(c.byRid[rid])
+}
+
+func (c *Cache) get(orderUID string) (*models.Order, bool) {
+	el, exists := c.data[orderUID]
+	if !exists {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if c.expired(e) {
+		c.remove(el)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	c.stats.Hits++
+	return e.order, true
 }
 
+// Delete removes the order and invalidates loads of it in progress.
 func (c *Cache) Delete(orderUID string) {
 	c.Lock()
 	defer c.Unlock()
-	delete(c.data, orderUID)
+	c.invalidate(orderUID)
+	if el, exists := c.data[orderUID]; exists {
+		c.remove(el)
+	}
+}
+
+// Invalidate removes the order unless the cached version has payloadHash
+// and reports whether an entry was removed. Either way loads of the order
+// in progress are invalidated.
+func (c *Cache) Invalidate(orderUID, payloadHash string) bool {
+	c.Lock()
+	defer c.Unlock()
+	c.invalidate(orderUID)
+	el, exists := c.data[orderUID]
+	if !exists || el.Value.(*entry).order.PayloadHash == payloadHash {
+		return false
+	}
+	c.remove(el)
+	return true
+}
+
+// Clear removes every order and invalidates all loads in progress;
+// statistics are kept.
+func (c *Cache) Clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	c.floor = c.generation
+	clear(c.invalidated)
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) invalidate(orderUID string) {
+	c.generation++
+	c.invalidated[orderUID] = c.generation
+	if len(c.invalidated) > c.pruneAt {
+		c.prune()
+	}
+}
+
+// prune drops the invalidations that no load in progress started before.
+// Records needed by a long load are kept, and pruning waits until their
+// number doubles.
+func (c *Cache) prune() {
+	oldest := c.generation
+	for generation := range c.loads {
+		oldest = min(oldest, generation)
+	}
+	for uid, generation := range c.invalidated {
+		if generation <= oldest {
+			delete(c.invalidated, uid)
+		}
+	}
+	c.pruneAt = max(minPruneAt, 2*len(c.invalidated))
 }
 
 func (c *Cache) Size() int {
-	c.RLock()
-	defer c.RUnlock()
+	c.Lock()
+	defer c.Unlock()
 	return len(c.data)
 }
 
+func (c *Cache) Stats() Stats {
+	c.Lock()
+	defer c.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.data)
+	stats.Bytes = c.bytes
+	return stats
+}
+
 func (c *Cache) GetAll() map[string]*models.Order {
-	c.RLock()
-	defer c.RUnlock()
-	
+	c.Lock()
+	defer c.Unlock()
+
 	result := make(map[string]*models.Order)
-	for k, v := range c.data {
-		result[k] = v
+	for k, el := range c.data {
+		if e := el.Value.(*entry); !c.expired(e) {
+			result[k] = e.order
+		}
 	}
 	return result
-}
\ No newline at end of file
+}
+
+func (c *Cache) expired(e *entry) bool {
+	return !e.expiresAt.IsZero() && c.now().After(e.expiresAt)
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.data, e.key)
+	c.bytes -= e.size
+	c.unindex(e)
+}
+
+func (c *Cache) index(e *entry) {
+	if e.order == nil {
+		return
+	}
+
+	for _, item := range e.order.Items {
+		if item.Rid != "" {
+			c.byRid[item.Rid] = e.key
+		}
+	}
+	if tx := e.order.Payment.Transaction; tx != "" {
+		c.byTransaction[tx] = e.key
+	}
+}
+
+// unindex drops index entries that still point at e, leaving entries that
+// were since claimed by another order untouched.
+func (c *Cache) unindex(e *entry) {
+	if e.order == nil {
+		return
+	}
+
+	for _, item := range e.order.Items {
+		if c.byRid[item.Rid] == e.key {
+			delete(c.byRid, item.Rid)
+		}
+	}
+	if tx := e.order.Payment.Transaction; c.byTransaction[tx] == e.key {
+		delete(c.byTransaction, tx)
+	}
+}
+
+// evict drops least recently used entries until the cache fits its limits.
+// The newest entry is always kept, even if it alone exceeds MaxBytes.
+func (c *Cache) evict() {
+	for c.lru.Len() > 1 && c.overLimit() {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) overLimit() bool {
+	if c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries {
+		return true
+	}
+	return c.opts.MaxBytes > 0 && c.bytes > c.opts.MaxBytes
+}
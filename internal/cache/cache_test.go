@@ -1,7 +1,9 @@
 package cache
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"order-service/internal/models"
 
@@ -42,4 +44,192 @@ func TestCacheConcurrent(t *testing.T) {
 	assert.True(t, exists2)
 	assert.Equal(t, "order1", order1.OrderUID)
 	assert.Equal(t, "order2", order2.OrderUID)
-}
\ No newline at end of file
+}
+func TestCacheLRUEviction(t *testing.T) {
+	cache := NewWithOptions(Options{MaxEntries: 2})
+
+	cache.Set("order1", &models.Order{OrderUID: "order1"})
+	cache.Set("order2", &models.Order{OrderUID: "order2"})
+
+	_, exists := cache.Get("order1")
+	assert.True(t, exists)
+
+	cache.Set("order3", &models.Order{OrderUID: "order3"})
+
+	assert.Equal(t, 2, cache.Size())
+	_, exists = cache.Get("order2")
+	assert.False(t, exists)
+	_, exists = cache.Get("order1")
+	assert.True(t, exists)
+	_, exists = cache.Get("order3")
+	assert.True(t, exists)
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, uint64(3), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	order := &models.Order{OrderUID: "order1", Items: []models.Item{{Name: "Mascaras"}}}
+	size := estimateSize(order)
+
+	cache := NewWithOptions(Options{MaxBytes: size * 2})
+	cache.Set("order1", order)
+	cache.Set("order2", &models.Order{OrderUID: "order2", Items: []models.Item{{Name: "Mascaras"}}})
+	cache.Set("order3", &models.Order{OrderUID: "order3", Items: []models.Item{{Name: "Mascaras"}}})
+
+	stats := cache.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.LessOrEqual(t, stats.Bytes, size*2)
+
+	_, exists := cache.Get("order1")
+	assert.False(t, exists)
+}
+
+func TestCacheReplaceKeepsAccounting(t *testing.T) {
+	cache := New()
+
+	cache.Set("order1", &models.Order{OrderUID: "order1"})
+	cache.Set("order1", &models.Order{OrderUID: "order1", TrackNumber: "TRACK"})
+
+	assert.Equal(t, 1, cache.Size())
+	order, _ := cache.Get("order1")
+	assert.Equal(t, "TRACK", order.TrackNumber)
+
+	cache.Delete("order1")
+	assert.Equal(t, int64(0), cache.Stats().Bytes)
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Now()
+	cache := NewWithOptions(Options{TTL: time.Minute})
+	cache.now = func() time.Time { return now }
+
+	cache.Set("order1", &models.Order{OrderUID: "order1"})
+
+	_, exists := cache.Get("order1")
+	assert.True(t, exists)
+
+	now = now.Add(2 * time.Minute)
+	assert.Empty(t, cache.GetAll())
+
+	_, exists = cache.Get("order1")
+	assert.False(t, exists)
+	assert.Equal(t, 0, cache.Size())
+	assert.Equal(t, uint64(1), cache.Stats().Expirations)
+}
+
+func TestCacheSecondaryIndexes(t *testing.T) {
+	cache := New()
+
+	order := &models.Order{
+		OrderUID:    "order1",
+		TrackNumber: "WBILMTESTTRACK",
+		Payment:     models.Payment{Transaction: "tx1"},
+		Items: []models.Item{
+			{Rid: "rid1", TrackNumber: "WBILMTESTTRACK"},
+			{Rid: "rid2", TrackNumber: "ITEMTRACK"},
+		},
+	}
+	cache.Set(order.OrderUID, order)
+
+	found, exists := cache.GetByTransaction("tx1")
+	assert.True(t, exists)
+	assert.Equal(t, "order1", found.OrderUID)
+
+	found, exists = cache.GetByRid("rid2")
+	assert.True(t, exists)
+	assert.Equal(t, "order1", found.OrderUID)
+
+	updated := &models.Order{
+		OrderUID:    "order1",
+		TrackNumber: "NEWTRACK",
+		Payment:     models.Payment{Transaction: "tx2"},
+	}
+	cache.Set(updated.OrderUID, updated)
+
+	_, exists = cache.GetByTransaction("tx1")
+	assert.False(t, exists)
+	_, exists = cache.GetByRid("rid1")
+	assert.False(t, exists)
+
+	cache.Delete("order1")
+	_, exists = cache.GetByTransaction("tx2")
+	assert.False(t, exists)
+	assert.Empty(t, cache.byTransaction)
+	assert.Empty(t, cache.byRid)
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	cache := New()
+	cache.Set("order1", &models.Order{OrderUID: "order1", PayloadHash: "v1", Payment: models.Payment{Transaction: "tx1"}})
+	cache.Set("order2", &models.Order{OrderUID: "order2", PayloadHash: "v1"})
+
+	assert.False(t, cache.Invalidate("order1", "v1"))
+	assert.False(t, cache.Invalidate("missing", "v2"))
+	assert.True(t, cache.Invalidate("order1", "v2"))
+
+	_, exists := cache.Get("order1")
+	assert.False(t, exists)
+	_, exists = cache.GetByTransaction("tx1")
+	assert.False(t, exists)
+
+	cache.Clear()
+	assert.Zero(t, cache.Size())
+	assert.Zero(t, cache.Stats().Bytes)
+}
+
+func TestCacheSetLoaded(t *testing.T) {
+	cache := New()
+
+	generation := cache.StartLoad()
+	assert.False(t, cache.Invalidate("order1", "v2"))
+	assert.False(t, cache.SetLoaded("order1", &models.Order{OrderUID: "order1", PayloadHash: "v1"}, generation))
+	assert.True(t, cache.SetLoaded("order2", &models.Order{OrderUID: "order2", PayloadHash: "v1"}, generation))
+
+	generation = cache.StartLoad()
+	assert.True(t, cache.SetLoaded("order1", &models.Order{OrderUID: "order1", PayloadHash: "v2"}, generation))
+
+	cache.Delete("order2")
+	assert.False(t, cache.SetLoaded("order2", &models.Order{OrderUID: "order2"}, generation))
+
+	generation = cache.StartLoad()
+	cache.Clear()
+	assert.False(t, cache.SetLoaded("order3", &models.Order{OrderUID: "order3"}, generation))
+	assert.True(t, cache.SetLoaded("order3", &models.Order{OrderUID: "order3"}, cache.StartLoad()))
+	assert.Equal(t, uint64(3), cache.Stats().RefusedLoads)
+}
+
+func TestCachePrunesInvalidations(t *testing.T) {
+	cache := New()
+
+	// A long load keeps the invalidations made since it started.
+	generation := cache.StartLoad()
+	for i := 0; i <= minPruneAt; i++ {
+		cache.Invalidate(fmt.Sprintf("order%d", i), "")
+	}
+	assert.Len(t, cache.invalidated, minPruneAt+1)
+	assert.False(t, cache.SetLoaded("order0", &models.Order{OrderUID: "order0"}, generation))
+	assert.True(t, cache.SetLoaded("other", &models.Order{OrderUID: "other"}, generation))
+
+	// Once it ends they are no longer needed.
+	cache.EndLoad(generation)
+	for i := 0; len(cache.invalidated) > 1; i++ {
+		cache.Invalidate(fmt.Sprintf("late%d", i), "")
+	}
+	assert.Equal(t, minPruneAt, cache.pruneAt)
+}
+
+func TestCacheSetLoadedKeepsNewer(t *testing.T) {
+	cache := New()
+	cache.Set("order1", &models.Order{OrderUID: "order1", SourceStream: "stan/orders", SourceSeq: 5})
+
+	generation := cache.StartLoad()
+	assert.False(t, cache.SetLoaded("order1", &models.Order{OrderUID: "order1", SourceStream: "stan/orders", SourceSeq: 4}, generation))
+	cached, _ := cache.Get("order1")
+	assert.Equal(t, uint64(5), cached.SourceSeq)
+
+	assert.True(t, cache.SetLoaded("order1", &models.Order{OrderUID: "order1", SourceStream: "stan/orders", SourceSeq: 6}, generation))
+	assert.True(t, cache.SetLoaded("order1", &models.Order{OrderUID: "order1", SourceStream: "kafka/orders", SourceSeq: 1}, generation))
+}
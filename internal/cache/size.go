@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"order-service/internal/models"
+	"unsafe"
+)
+
+const (
+	entryOverhead = int64(unsafe.Sizeof(entry{})) + 64
+	orderSize     = int64(unsafe.Sizeof(models.Order{}))
+	itemSize      = int64(unsafe.Sizeof(models.Item{}))
+)
+
+// estimateSize approximates the memory held by an order: struct sizes plus
+// string contents. It ignores allocator overhead, so MaxBytes is a soft limit.
+func estimateSize(o *models.Order) int64 {
+	if o == nil {
+		return entryOverhead
+	}
+
+	size := entryOverhead + orderSize
+	size += strLen(o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature, o.CustomerID,
+		o.DeliveryService, o.Shardkey, o.OofShard, o.SourceStream, o.PayloadHash)
+
+	d := o.Delivery
+	size += strLen(d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email)
+
+	p := o.Payment
+	size += strLen(p.Transaction, p.RequestID, p.Currency, p.Provider, p.Bank)
+
+	for _, item := range o.Items {
+		size += itemSize + strLen(item.TrackNumber, item.Rid, item.Name, item.Size, item.Brand)
+	}
+	for _, v := range o.Violations {
+		size += strLen(v.Rule, v.Action, v.Message)
+	}
+	return size
+}
+
+func strLen(values ...string) int64 {
+	var n int64
+	for _, v := range values {
+		n += int64(len(v))
+	}
+	return n
+}
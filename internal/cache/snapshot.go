@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"order-service/internal/models"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotVersion = 1
+
+// Snapshot is a copy of the cache that is saved to a file and loaded on the
+// next start. Orders are listed least recently used first, so loading them
+// in order restores the LRU order.
+type Snapshot struct {
+	CreatedAt time.Time
+	// LastSequence is the highest source sequence among the orders, per
+	// stream.
+	LastSequence map[string]uint64
+	Orders       []*models.Order
+}
+
+// snapshotFile is stored as gzipped JSON. Checksum is the SHA-256 of the
+// Orders bytes.
+type snapshotFile struct {
+	Version      int               `json:"version"`
+	CreatedAt    time.Time         `json:"created_at"`
+	LastSequence map[string]uint64 `json:"last_sequence"`
+	Checksum     string            `json:"checksum"`
+	Orders       json.RawMessage   `json:"orders"`
+}
+
+// snapshotEntry keeps the version fields that Order leaves out of its JSON.
+type snapshotEntry struct {
+	Order        *models.Order `json:"order"`
+	SourceStream string        `json:"source_stream"`
+	SourceSeq    uint64        `json:"source_seq"`
+	PayloadHash  string        `json:"payload_hash"`
+}
+
+// Snapshot copies the unexpired orders. Cached orders are replaced rather
+// than modified, so they can be encoded after the lock is released.
+func (c *Cache) Snapshot() *Snapshot {
+	c.Lock()
+	defer c.Unlock()
+
+	snap := &Snapshot{
+		CreatedAt:    c.now(),
+		LastSequence: make(map[string]uint64),
+		Orders:       make([]*models.Order, 0, len(c.data)),
+	}
+	for el := c.lru.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*entry)
+		if c.expired(e) {
+			continue
+		}
+		snap.Orders = append(snap.Orders, e.order)
+		if e.order.SourceStream != "" && e.order.SourceSeq > snap.LastSequence[e.order.SourceStream] {
+			snap.LastSequence[e.order.SourceStream] = e.order.SourceSeq
+		}
+	}
+	return snap
+}
+
+// Save writes the snapshot next to path and renames it into place, so that
+// a crash never leaves a partial snapshot behind.
+func (s *Snapshot) Save(path string) error {
+	entries := make([]snapshotEntry, len(s.Orders))
+	for i, order := range s.Orders {
+		entries[i] = snapshotEntry{
+			Order:        order,
+			SourceStream: order.SourceStream,
+			SourceSeq:    order.SourceSeq,
+			PayloadHash:  order.PayloadHash,
+		}
+	}
+	orders, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(orders)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := gzip.NewWriter(tmp)
+	err = json.NewEncoder(zw).Encode(snapshotFile{
+		Version:      snapshotVersion,
+		CreatedAt:    s.CreatedAt,
+		LastSequence: s.LastSequence,
+		Checksum:     hex.EncodeToString(sum[:]),
+		Orders:       orders,
+	})
+	if err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot reads a snapshot written by Save and verifies its checksum.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %v", err)
+	}
+	var file snapshotFile
+	if err := json.NewDecoder(zr).Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %v", err)
+	}
+	if file.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", file.Version)
+	}
+	if sum := sha256.Sum256(file.Orders); hex.EncodeToString(sum[:]) != file.Checksum {
+		return nil, fmt.Errorf("snapshot checksum mismatch")
+	}
+
+	var entries []snapshotEntry
+	if err := json.Unmarshal(file.Orders, &entries); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %v", err)
+	}
+	snap := &Snapshot{
+		CreatedAt:    file.CreatedAt,
+		LastSequence: file.LastSequence,
+		Orders:       make([]*models.Order, 0, len(entries)),
+	}
+	for _, e := range entries {
+		if e.Order == nil {
+			continue
+		}
+		e.Order.SourceStream = e.SourceStream
+		e.Order.SourceSeq = e.SourceSeq
+		e.Order.PayloadHash = e.PayloadHash
+		snap.Orders = append(snap.Orders, e.Order)
+	}
+	return snap, nil
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"order-service/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	now := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	cache := NewWithOptions(Options{TTL: time.Hour})
+	cache.now = func() time.Time { return now }
+
+	cache.Set("old", &models.Order{OrderUID: "old", SourceStream: "stan/orders", SourceSeq: 3})
+	now = now.Add(50 * time.Minute)
+	cache.Set("a", &models.Order{OrderUID: "a", SourceStream: "stan/orders", SourceSeq: 7, PayloadHash: "h7"})
+	cache.Set("b", &models.Order{OrderUID: "b", SourceStream: "jetstream/orders", SourceSeq: 2})
+	cache.Get("a")
+	now = now.Add(20 * time.Minute)
+
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	assert.NoError(t, cache.Snapshot().Save(path))
+
+	snap, err := LoadSnapshot(path)
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(snap.CreatedAt))
+	assert.Equal(t, map[string]uint64{"stan/orders": 7, "jetstream/orders": 2}, snap.LastSequence)
+
+	// The expired order is left out, the rest is least recently used first.
+	assert.Len(t, snap.Orders, 2)
+	assert.Equal(t, "b", snap.Orders[0].OrderUID)
+	assert.Equal(t, "a", snap.Orders[1].OrderUID)
+	assert.Equal(t, uint64(7), snap.Orders[1].SourceSeq)
+	assert.Equal(t, "h7", snap.Orders[1].PayloadHash)
+
+	entries, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	assert.Empty(t, entries)
+}
+
+func TestLoadSnapshotRejectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	cache := New()
+	cache.Set("a", &models.Order{OrderUID: "a"})
+
+	path := filepath.Join(dir, "cache.snapshot")
+	assert.NoError(t, cache.Snapshot().Save(path))
+
+	// Rewrite the snapshot with a changed order but the old checksum.
+	f, _ := os.Open(path)
+	zr, _ := gzip.NewReader(f)
+	var file snapshotFile
+	assert.NoError(t, json.NewDecoder(zr).Decode(&file))
+	f.Close()
+	file.Orders = json.RawMessage(`[{"order":{"order_uid":"b"}}]`)
+
+	out, _ := os.Create(path)
+	zw := gzip.NewWriter(out)
+	assert.NoError(t, json.NewEncoder(zw).Encode(file))
+	zw.Close()
+	out.Close()
+
+	_, err := LoadSnapshot(path)
+	assert.ErrorContains(t, err, "checksum")
+
+	assert.NoError(t, os.WriteFile(path, []byte("not gzip"), 0o644))
+	_, err = LoadSnapshot(path)
+	assert.Error(t, err)
+
+	_, err = LoadSnapshot(filepath.Join(dir, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
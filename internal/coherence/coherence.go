@@ -0,0 +1,113 @@
+// Package coherence keeps the caches of several service replicas in step.
+// A trigger on orders notifies the order_changes channel on every write;
+// each replica listens to it and drops cached orders that another replica
+// (or anyone else) changed, so that the next read loads the stored version.
+package coherence
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"order-service/internal/cache"
+	"order-service/internal/metrics"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Channel is the notification channel written by the orders trigger.
+const Channel = "order_changes"
+
+// change is the payload of a notification. Inserts and updates carry the
+// payload hash of the stored version, so that a replica holding that version
+// keeps it.
+type change struct {
+	Op          string `json:"op"`
+	OrderUID    string `json:"order_uid"`
+	PayloadHash string `json:"payload_hash"`
+}
+
+type Listener struct {
+	cache    *cache.Cache
+	listener *pq.Listener
+	done     chan struct{}
+}
+
+// New prepares a listener on its own connection; pq reconnects it with a
+// backoff between minReconnect and maxReconnect.
+func New(connStr string, cache *cache.Cache, minReconnect, maxReconnect time.Duration) *Listener {
+	l := &Listener{cache: cache}
+	l.listener = pq.NewListener(connStr, minReconnect, maxReconnect, l.event)
+	return l
+}
+
+func (l *Listener) Start() error {
+	if err := l.listener.Listen(Channel); err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", Channel, err)
+	}
+	l.done = make(chan struct{})
+	go l.run()
+	return nil
+}
+
+func (l *Listener) run() {
+	defer close(l.done)
+	for n := range l.listener.Notify {
+		l.apply(n)
+	}
+}
+
+// apply handles a notification. pq sends nil after a reconnect, when
+// notifications may have been lost, so the whole cache is dropped then.
+func (l *Listener) apply(n *pq.Notification) {
+	if n == nil {
+		l.cache.Clear()
+		metrics.CacheInvalidations.WithLabelValues(metrics.InvalidateReconnect).Inc()
+		log.Println("Order change notifications may have been lost, cache cleared")
+		return
+	}
+
+	var c change
+	if err := json.Unmarshal([]byte(n.Extra), &c); err != nil {
+		log.Printf("Invalid order change notification %q: %v", n.Extra, err)
+		return
+	}
+
+	switch c.Op {
+	case "delete":
+		l.cache.Delete(c.OrderUID)
+	case "set":
+		if !l.cache.Invalidate(c.OrderUID, c.PayloadHash) {
+			return
+		}
+	default:
+		log.Printf("Unknown order change %q for order %s", c.Op, c.OrderUID)
+		return
+	}
+	metrics.CacheInvalidations.WithLabelValues(metrics.InvalidateChange).Inc()
+}
+
+func (l *Listener) event(ev pq.ListenerEventType, err error) {
+	switch ev {
+	case pq.ListenerEventDisconnected:
+		log.Printf("Order change listener disconnected: %v", err)
+	case pq.ListenerEventReconnected:
+		log.Println("Order change listener reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		log.Printf("Order change listener failed to reconnect: %v", err)
+	}
+}
+
+// Ping checks the listener connection.
+func (l *Listener) Ping() error {
+	return l.listener.Ping()
+}
+
+// Close stops listening; it waits for the notification being applied.
+func (l *Listener) Close() error {
+	err := l.listener.Close()
+	if l.done != nil {
+		<-l.done
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package coherence
+
+import (
+	"testing"
+	"time"
+
+	"order-service/internal/cache"
+	"order-service/internal/models"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func notification(extra string) *pq.Notification {
+	return &pq.Notification{Channel: Channel, Extra: extra}
+}
+
+func TestApply(t *testing.T) {
+	c := cache.New()
+	for _, uid := range []string{"a", "b", "c"} {
+		c.Set(uid, &models.Order{OrderUID: uid, PayloadHash: "v1"})
+	}
+	l := New("", c, time.Second, time.Minute)
+	defer l.Close()
+
+	l.apply(notification(`{"op":"set","order_uid":"a","payload_hash":"v1"}`))
+	_, ok := c.Get("a")
+	assert.True(t, ok, "the cached version is the stored one")
+
+	l.apply(notification(`{"op":"set","order_uid":"b","payload_hash":"v2"}`))
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+
+	l.apply(notification(`{"op":"delete","order_uid":"c"}`))
+	_, ok = c.Get("c")
+	assert.False(t, ok)
+
+	l.apply(notification(`not json`))
+	l.apply(notification(`{"op":"truncate"}`))
+	assert.Equal(t, 1, c.Size())
+
+	l.apply(nil)
+	assert.Zero(t, c.Size())
+}
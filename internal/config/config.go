@@ -2,37 +2,146 @@ package config
 
 import (
 	"os"
+	"regexp"
 	"strconv"
+	"time"
 )
 
 type Config struct {
-	DBHost          string
-	DBPort          int
-	DBUser          string
-	DBPassword      string
-	DBName          string
-	NATSClusterID   string
-	NATSClientID    string
-	NATSChannel     string
-	NATSDurableID   string
+	DBHost        string
+	DBPort        int
+	DBUser        string
+	DBPassword    string
+	DBName        string
+	DBAutoMigrate bool
+	NATSClusterID string
+	NATSClientID  string
+	NATSChannel   string
+	NATSDurableID string
+	// NATSQueueGroup makes replicas share the NATS Streaming channel. It is
+	// empty by default: a new group starts at the end of the channel.
+	NATSQueueGroup   string
+	NATSAckWait      time.Duration
+	NATSMaxInflight  int
+	NATSDeadLetter   string
+	NATSReconnectMin time.Duration
+	NATSReconnectMax time.Duration
+	// NATSStatusChannel carries order status events. It is consumed over
+	// JetStream when jetstream is among IngestSources, otherwise over NATS
+	// Streaming when stan is; empty disables it.
+	NATSStatusChannel string
+	// NATSStatusMaxDeliver bounds the NATS Streaming deliveries of a status
+	// event for an order that is not stored yet; JetStream uses
+	// JetStreamMaxDeliver.
+	NATSStatusMaxDeliver int
+	// IngestSources lists the brokers to consume, e.g. "stan,jetstream"
+	// while producers migrate. The first one also receives dead letters.
+	IngestSources string
+	IngestWorkers int
+	// IngestBatchSize above 1 stores messages in batches of up to that
+	// many, collected for at most IngestBatchWindow.
+	IngestBatchSize     int
+	IngestBatchWindow   time.Duration
+	NATSURL             string
+	JetStreamStream     string
+	JetStreamMaxDeliver int
+	KafkaBrokers        string
+	KafkaTopic          string
+	KafkaGroupID        string
+	// OutboxInterval is how often order events are relayed to JetStream,
+	// or to NATS Streaming without it, at most OutboxBatchSize per
+	// transaction. With Kafka alone they are not relayed.
+	OutboxInterval  time.Duration
+	OutboxBatchSize int
 	HTTPPort        string
+	ShutdownTimeout time.Duration
+	CacheMaxEntries int
+	CacheMaxBytes   int
+	CacheTTL        time.Duration
+	// CacheCoherence drops cached orders changed by other replicas, as
+	// notified by Postgres. Needed when several replicas serve the API.
+	CacheCoherence bool
+	RestoreMaxAge  time.Duration
+	RestoreLimit   int
+	RestoreBatch   int
+	// CacheSnapshotPath enables saving the cache there every
+	// CacheSnapshotInterval and at shutdown, and loading it at startup.
+	CacheSnapshotPath     string
+	CacheSnapshotInterval time.Duration
+	// ConsistencyRules maps rule names to actions, e.g. "goods_total=reject".
+	ConsistencyRules string
 }
 
 func Load() *Config {
+	queueGroup := getEnv("NATS_QUEUE_GROUP", "")
 	return &Config{
-		DBHost:        getEnv("DB_HOST", "localhost"),
-		DBPort:        getEnvAsInt("DB_PORT", 5433),
-		DBUser:        getEnv("DB_USER", "myuser"),
-		DBPassword:    getEnv("DB_PASSWORD", "mypassword"),
-		DBName:        getEnv("DB_NAME", "myapp"),
-		NATSClusterID: getEnv("NATS_CLUSTER_ID", "my-cluster"),
-		NATSClientID:  getEnv("NATS_CLIENT_ID", "order-service"),
-		NATSChannel:   getEnv("NATS_CHANNEL", "orders"),
-		NATSDurableID: getEnv("NATS_DURABLE_ID", "order-service-durable"),
-		HTTPPort:      getEnv("HTTP_PORT", "8080"),
+		DBHost:                getEnv("DB_HOST", "localhost"),
+		DBPort:                getEnvAsInt("DB_PORT", 5433),
+		DBUser:                getEnv("DB_USER", "myuser"),
+		DBPassword:            getEnv("DB_PASSWORD", "mypassword"),
+		DBName:                getEnv("DB_NAME", "myapp"),
+		DBAutoMigrate:         getEnvAsBool("DB_AUTO_MIGRATE", true),
+		NATSClusterID:         getEnv("NATS_CLUSTER_ID", "my-cluster"),
+		NATSClientID:          getEnv("NATS_CLIENT_ID", defaultClientID(queueGroup)),
+		NATSChannel:           getEnv("NATS_CHANNEL", "orders"),
+		NATSDurableID:         getEnv("NATS_DURABLE_ID", "order-service-durable"),
+		NATSQueueGroup:        queueGroup,
+		NATSAckWait:           getEnvAsDuration("NATS_ACK_WAIT", 30*time.Second),
+		NATSMaxInflight:       getEnvAsInt("NATS_MAX_INFLIGHT", 32),
+		NATSDeadLetter:        getEnv("NATS_DEAD_LETTER_CHANNEL", "orders-dead-letter"),
+		NATSReconnectMin:      getEnvAsDuration("NATS_RECONNECT_MIN", time.Second),
+		NATSReconnectMax:      getEnvAsDuration("NATS_RECONNECT_MAX", 30*time.Second),
+		NATSStatusChannel:     getEnv("NATS_STATUS_CHANNEL", "order-status"),
+		NATSStatusMaxDeliver:  getEnvAsInt("NATS_STATUS_MAX_DELIVER", 10),
+		IngestSources:         getEnv("INGEST_SOURCES", "stan"),
+		IngestWorkers:         getEnvAsInt("INGEST_WORKERS", 8),
+		IngestBatchSize:       getEnvAsInt("INGEST_BATCH_SIZE", 0),
+		IngestBatchWindow:     getEnvAsDuration("INGEST_BATCH_WINDOW", 50*time.Millisecond),
+		NATSURL:               getEnv("NATS_URL", "nats://localhost:4222"),
+		JetStreamStream:       getEnv("JETSTREAM_STREAM", "ORDERS"),
+		JetStreamMaxDeliver:   getEnvAsInt("JETSTREAM_MAX_DELIVER", 5),
+		KafkaBrokers:          getEnv("KAFKA_BROKERS", "localhost:9092"),
+		KafkaTopic:            getEnv("KAFKA_TOPIC", "orders"),
+		KafkaGroupID:          getEnv("KAFKA_GROUP_ID", "order-service"),
+		OutboxInterval:        getEnvAsDuration("OUTBOX_INTERVAL", time.Second),
+		OutboxBatchSize:       getEnvAsInt("OUTBOX_BATCH_SIZE", 100),
+		HTTPPort:              getEnv("HTTP_PORT", "8080"),
+		ShutdownTimeout:       getEnvAsDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+		CacheMaxEntries:       getEnvAsInt("CACHE_MAX_ENTRIES", 100000),
+		CacheMaxBytes:         getEnvAsInt("CACHE_MAX_BYTES", 256<<20),
+		CacheTTL:              getEnvAsDuration("CACHE_TTL", 0),
+		CacheCoherence:        getEnvAsBool("CACHE_COHERENCE", true),
+		RestoreMaxAge:         getEnvAsDuration("RESTORE_MAX_AGE", 0),
+		RestoreLimit:          getEnvAsInt("RESTORE_LIMIT", 0),
+		RestoreBatch:          getEnvAsInt("RESTORE_BATCH_SIZE", 500),
+		CacheSnapshotPath:     getEnv("CACHE_SNAPSHOT_PATH", ""),
+		CacheSnapshotInterval: getEnvAsDuration("CACHE_SNAPSHOT_INTERVAL", 5*time.Minute),
+		ConsistencyRules: getEnv("CONSISTENCY_RULES",
+			"goods_total=flag,payment_amount=flag,item_total_price=flag"),
 	}
 }
 
+var invalidClientID = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// defaultClientID names the replica after its pod or host, since NATS
+// Streaming allows one connection per client ID. Without a queue group the
+// durable subscription belongs to the client ID, which then stays fixed.
+func defaultClientID(queueGroup string) string {
+	if queueGroup == "" {
+		return "order-service"
+	}
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		if host, err := os.Hostname(); err == nil && host != "" {
+			name = "order-service-" + host
+		}
+	}
+	if name = invalidClientID.ReplaceAllString(name, "-"); name == "" {
+		return "order-service"
+	}
+	return name
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -47,4 +156,22 @@ func getEnvAsInt(key string, defaultValue int) int {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,159 @@
+package consistency
+
+import (
+	"fmt"
+	"order-service/internal/models"
+	"strings"
+)
+
+// Action is what happens to an order that violates a rule: warn only logs
+// the violation, flag also stores it with the order and reject turns the
+// order down.
+type Action string
+
+const (
+	Accept Action = "accept"
+	Warn   Action = "warn"
+	Flag   Action = "flag"
+	Reject Action = "reject"
+)
+
+type Rule struct {
+	Name  string
+	Check func(order *models.Order) error
+}
+
+var Rules = []Rule{
+	{Name: "goods_total", Check: checkGoodsTotal},
+	{Name: "payment_amount", Check: checkPaymentAmount},
+	{Name: "item_total_price", Check: checkItemTotalPrice},
+}
+
+type Engine struct {
+	rules   []Rule
+	actions map[string]Action
+}
+
+// New builds an engine over Rules. Rules missing from actions are accepted
+// without being checked.
+func New(actions map[string]Action) *Engine {
+	return &Engine{
+		rules:   Rules,
+		actions: actions,
+	}
+}
+
+// ParseActions parses a spec like "goods_total=flag,payment_amount=reject".
+func ParseActions(spec string) (map[string]Action, error) {
+	actions := make(map[string]Action)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule setting %q", part)
+		}
+		name = strings.TrimSpace(name)
+		if !knownRule(name) {
+			return nil, fmt.Errorf("unknown consistency rule %q", name)
+		}
+
+		action := Action(strings.TrimSpace(value))
+		switch action {
+		case Accept, Warn, Flag, Reject:
+		default:
+			return nil, fmt.Errorf("unknown action %q for rule %s", action, name)
+		}
+		actions[name] = action
+	}
+	return actions, nil
+}
+
+func knownRule(name string) bool {
+	for _, rule := range Rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type Result struct {
+	Violations []models.RuleViolation
+}
+
+// Rejected returns the first violation whose rule is configured to reject.
+func (r Result) Rejected() *models.RuleViolation {
+	for i := range r.Violations {
+		if r.Violations[i].Action == string(Reject) {
+			return &r.Violations[i]
+		}
+	}
+	return nil
+}
+
+// Flagged returns the violations to be stored with the order, leaving out
+// those that are only logged.
+func (r Result) Flagged() []models.RuleViolation {
+	var flagged []models.RuleViolation
+	for _, v := range r.Violations {
+		if v.Action != string(Warn) {
+			flagged = append(flagged, v)
+		}
+	}
+	return flagged
+}
+
+func (e *Engine) Evaluate(order *models.Order) Result {
+	var result Result
+	for _, rule := range e.rules {
+		action, ok := e.actions[rule.Name]
+		if !ok || action == Accept {
+			continue
+		}
+		if err := rule.Check(order); err != nil {
+			result.Violations = append(result.Violations, models.RuleViolation{
+				Rule:    rule.Name,
+				Action:  string(action),
+				Message: err.Error(),
+			})
+		}
+	}
+	return result
+}
+
+func checkGoodsTotal(order *models.Order) error {
+	sum := 0
+	for _, item := range order.Items {
+		sum += item.TotalPrice
+	}
+	if sum != order.Payment.GoodsTotal {
+		return fmt.Errorf("goods_total %d does not match items total %d", order.Payment.GoodsTotal, sum)
+	}
+	return nil
+}
+
+func checkPaymentAmount(order *models.Order) error {
+	p := order.Payment
+	expected := p.GoodsTotal + p.DeliveryCost + p.CustomFee
+	if p.Amount != expected {
+		return fmt.Errorf("amount %d does not match goods_total + delivery_cost + custom_fee = %d", p.Amount, expected)
+	}
+	return nil
+}
+
+// checkItemTotalPrice allows producers to round the discounted price either way.
+func checkItemTotalPrice(order *models.Order) error {
+	for i, item := range order.Items {
+		exact := item.Price * (100 - item.Sale)
+		diff := item.TotalPrice*100 - exact
+		if diff <= -100 || diff >= 100 {
+			return fmt.Errorf("items[%d].total_price %d does not match price %d with sale %d%%",
+				i, item.TotalPrice, item.Price, item.Sale)
+		}
+	}
+	return nil
+}
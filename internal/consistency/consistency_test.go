@@ -0,0 +1,93 @@
+package consistency
+
+import (
+	"testing"
+
+	"order-service/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func consistentOrder() *models.Order {
+	return &models.Order{
+		OrderUID: "test-123",
+		Payment: models.Payment{
+			Amount:       1817,
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []models.Item{
+			{Price: 453, Sale: 30, TotalPrice: 317},
+		},
+	}
+}
+
+func TestParseActions(t *testing.T) {
+	actions, err := ParseActions("goods_total=reject, payment_amount=flag,item_total_price=warn")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Action{
+		"goods_total":      Reject,
+		"payment_amount":   Flag,
+		"item_total_price": Warn,
+	}, actions)
+
+	_, err = ParseActions("unknown_rule=flag")
+	assert.Error(t, err)
+
+	_, err = ParseActions("goods_total=explode")
+	assert.Error(t, err)
+
+	_, err = ParseActions("goods_total")
+	assert.Error(t, err)
+}
+
+func TestEvaluateConsistentOrder(t *testing.T) {
+	engine := New(map[string]Action{
+		"goods_total":      Reject,
+		"payment_amount":   Reject,
+		"item_total_price": Reject,
+	})
+
+	result := engine.Evaluate(consistentOrder())
+	assert.Empty(t, result.Violations)
+	assert.Nil(t, result.Rejected())
+}
+
+func TestEvaluateViolations(t *testing.T) {
+	engine := New(map[string]Action{
+		"goods_total":      Flag,
+		"payment_amount":   Reject,
+		"item_total_price": Warn,
+	})
+
+	order := consistentOrder()
+	order.Payment.GoodsTotal = 337
+	order.Items[0].TotalPrice = 400
+
+	result := engine.Evaluate(order)
+	assert.Len(t, result.Violations, 3)
+	assert.Equal(t, "goods_total", result.Violations[0].Rule)
+	assert.Equal(t, "flag", result.Violations[0].Action)
+	assert.Equal(t, "item_total_price", result.Violations[2].Rule)
+	assert.Equal(t, "warn", result.Violations[2].Action)
+
+	rejected := result.Rejected()
+	assert.NotNil(t, rejected)
+	assert.Equal(t, "payment_amount", rejected.Rule)
+
+	flagged := result.Flagged()
+	assert.Len(t, flagged, 2)
+	assert.Equal(t, "goods_total", flagged[0].Rule)
+	assert.Equal(t, "payment_amount", flagged[1].Rule)
+}
+
+func TestEvaluateSkipsAcceptedRules(t *testing.T) {
+	engine := New(map[string]Action{"goods_total": Accept})
+
+	order := consistentOrder()
+	order.Payment.GoodsTotal = 0
+	order.Payment.Amount = 0
+
+	result := engine.Evaluate(order)
+	assert.Empty(t, result.Violations)
+}
@@ -1,20 +1,26 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"order-service/internal/models"
 	"order-service/internal/service"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
 	service service.OrderService
+	checks  []Check
 }
 
-func New(service service.OrderService) *Handler {
+func New(service service.OrderService, checks ...Check) *Handler {
 	return &Handler{
 		service: service,
+		checks:  checks,
 	}
 }
 
@@ -26,14 +32,161 @@ func (h *Handler) GetOrder(c *gin.Context) {
 	}
 
 	order, err := h.service.GetOrder(orderID)
+	h.respondOrder(c, order, err, orderID)
+}
+
+func (h *Handler) GetOrderHistory(c *gin.Context) {
+	orderID := c.Param("id")
+	versions, err := h.service.GetOrderHistory(orderID)
+	if errors.Is(err, service.ErrOrderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
 	if err != nil {
+		log.Printf("Error getting history of order %s: %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+func (h *Handler) GetOrderStatus(c *gin.Context) {
+	orderID := c.Param("id")
+	timeline, err := h.service.GetOrderStatus(orderID)
+	if errors.Is(err, service.ErrOrderNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
+	if err != nil {
+		log.Printf("Error getting status of order %s: %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, timeline)
+}
+
+func (h *Handler) GetOrderByTransaction(c *gin.Context) {
+	transaction := c.Param("transaction")
+	order, err := h.service.FindByTransaction(transaction)
+	h.respondOrder(c, order, err, transaction)
+}
+
+func (h *Handler) GetOrderByRid(c *gin.Context) {
+	rid := c.Param("rid")
+	order, err := h.service.FindByRid(rid)
+	h.respondOrder(c, order, err, rid)
+}
+
+func (h *Handler) GetOrdersByTrackNumber(c *gin.Context) {
+	trackNumber := c.Param("track")
+	orders, err := h.service.FindByTrackNumber(trackNumber)
+	if errors.Is(err, service.ErrOrderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up track number %s: %v", trackNumber, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"orders": orders})
+}
+
+func (h *Handler) respondOrder(c *gin.Context, order *models.Order, err error, key string) {
+	if errors.Is(err, service.ErrOrderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting order %s: %v", key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
 
 	c.JSON(http.StatusOK, order)
 }
 
+func (h *Handler) ListOrders(c *gin.Context) {
+	filter := service.OrderFilter{
+		CustomerID:      c.Query("customer_id"),
+		TrackNumber:     c.Query("track_number"),
+		DeliveryService: c.Query("delivery_service"),
+		Provider:        c.Query("provider"),
+		Currency:        c.Query("currency"),
+		Brand:           c.Query("brand"),
+		Cursor:          c.Query("cursor"),
+	}
+
+	var err error
+	if filter.CreatedFrom, _, err = parseTimeQuery(c, "date_from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	createdTo, dateOnly, err := parseTimeQuery(c, "date_to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// date_to is exclusive, so a bare date has to cover the whole day.
+	if dateOnly {
+		createdTo = createdTo.AddDate(0, 0, 1)
+	}
+	filter.CreatedTo = createdTo
+	if filter.NmID, err = parseIntQuery(c, "nm_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Limit, err = parseIntQuery(c, "limit"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.service.ListOrders(filter)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing orders: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// parseTimeQuery accepts either a date (2006-01-02) or an RFC 3339 timestamp
+// and reports whether the value was a bare date.
+func parseTimeQuery(c *gin.Context, name string) (time.Time, bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, errors.New(name + " must be a date or RFC 3339 timestamp")
+	}
+	return t, false, nil
+}
+
+func parseIntQuery(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, errors.New(name + " must be a non-negative integer")
+	}
+	return n, nil
+}
+
 func (h *Handler) WebInterface(c *gin.Context) {
 	c.HTML(http.StatusOK, "index.html", nil)
 }
@@ -42,5 +195,6 @@ func (h *Handler) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "healthy",
 		"cacheSize": h.service.GetCacheSize(),
+		"cache":     h.service.GetCacheStats(),
 	})
-}
\ No newline at end of file
+}
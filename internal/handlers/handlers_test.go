@@ -1,31 +1,78 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"order-service/internal/cache"
 	"order-service/internal/models"
+	"order-service/internal/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockService struct {
-	order *models.Order
-	err   error
+	order    *models.Order
+	orders   []*models.Order
+	key      string
+	page     *service.OrderPage
+	filter   service.OrderFilter
+	versions []models.OrderVersion
+	timeline *models.StatusTimeline
+	err      error
 }
 
-func (m *mockService) ProcessMessage(data []byte) error {
+func (m *mockService) ProcessMessage(msg service.Message) error {
 	return m.err
 }
 
+func (m *mockService) ProcessStatusEvent(msg service.Message) error {
+	return m.err
+}
+
+func (m *mockService) ProcessBatch(batch []service.Message) []error {
+	return make([]error, len(batch))
+}
+
 func (m *mockService) GetOrder(orderUID string) (*models.Order, error) {
 	return m.order, m.err
 }
 
+func (m *mockService) GetOrderHistory(orderUID string) ([]models.OrderVersion, error) {
+	m.key = orderUID
+	return m.versions, m.err
+}
+
+func (m *mockService) GetOrderStatus(orderUID string) (*models.StatusTimeline, error) {
+	m.key = orderUID
+	return m.timeline, m.err
+}
+
+func (m *mockService) ListOrders(filter service.OrderFilter) (*service.OrderPage, error) {
+	m.filter = filter
+	return m.page, m.err
+}
+
+func (m *mockService) FindByTrackNumber(trackNumber string) ([]*models.Order, error) {
+	m.key = trackNumber
+	return m.orders, m.err
+}
+
+func (m *mockService) FindByTransaction(transaction string) (*models.Order, error) {
+	m.key = transaction
+	return m.order, m.err
+}
+
+func (m *mockService) FindByRid(rid string) (*models.Order, error) {
+	m.key = rid
+	return m.order, m.err
+}
+
 func (m *mockService) GetCacheSize() int {
 	if m.order != nil {
 		return 1
@@ -33,7 +80,19 @@ func (m *mockService) GetCacheSize() int {
 	return 0
 }
 
-func (m *mockService) RestoreCache() error {
+func (m *mockService) GetCacheStats() cache.Stats {
+	return cache.Stats{Entries: m.GetCacheSize()}
+}
+
+func (m *mockService) RestoreCache(ctx context.Context) error {
+	return m.err
+}
+
+func (m *mockService) SaveSnapshot() error {
+	return m.err
+}
+
+func (m *mockService) DeadLetter(letter *models.DeadLetter) error {
 	return m.err
 }
 
@@ -68,7 +127,7 @@ func TestGetOrderHandler(t *testing.T) {
 }
 
 func TestGetOrderHandlerNotFound(t *testing.T) {
-	mockSvc := &mockService{order: nil, err: assert.AnError}
+	mockSvc := &mockService{order: nil, err: service.ErrOrderNotFound}
 	handler := New(mockSvc)
 
 	router := gin.New()
@@ -83,6 +142,22 @@ func TestGetOrderHandlerNotFound(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
+func TestGetOrderHandlerInternalError(t *testing.T) {
+	mockSvc := &mockService{order: nil, err: assert.AnError}
+	handler := New(mockSvc)
+
+	router := gin.New()
+	router.GET("/api/order/:id", handler.GetOrder)
+
+	req, err := http.NewRequest("GET", "/api/order/test-order-123", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
 func TestGetOrderHandlerBadRequest(t *testing.T) {
 	mockSvc := &mockService{}
 	handler := New(mockSvc)
@@ -99,6 +174,72 @@ func TestGetOrderHandlerBadRequest(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
+func TestGetOrderHistoryHandler(t *testing.T) {
+	mockSvc := &mockService{versions: []models.OrderVersion{
+		{ID: 1, OrderUID: "test-order-123", Payload: json.RawMessage(`{"track_number":"A"}`)},
+		{ID: 2, OrderUID: "test-order-123", Payload: json.RawMessage(`{"track_number":"B"}`),
+			Diff: map[string]models.FieldChange{"track_number": {Old: json.RawMessage(`"A"`), New: json.RawMessage(`"B"`)}}},
+	}}
+	handler := New(mockSvc)
+
+	router := gin.New()
+	router.GET("/api/order/:id/history", handler.GetOrderHistory)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/order/test-order-123/history", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "test-order-123", mockSvc.key)
+
+	var response struct {
+		Versions []models.OrderVersion `json:"versions"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response.Versions, 2)
+	assert.JSONEq(t, `"B"`, string(response.Versions[1].Diff["track_number"].New))
+
+	for err, code := range map[error]int{
+		service.ErrOrderNotFound: http.StatusNotFound,
+		assert.AnError:           http.StatusInternalServerError,
+	} {
+		mockSvc.err = err
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/order/nonexistent/history", nil))
+		assert.Equal(t, code, rr.Code)
+	}
+}
+
+func TestGetOrderStatusHandler(t *testing.T) {
+	mockSvc := &mockService{timeline: &models.StatusTimeline{
+		OrderUID: "test-order-123",
+		Status:   models.StatusPaid,
+		Timeline: []models.StatusTransition{
+			{To: models.StatusCreated},
+			{From: models.StatusCreated, To: models.StatusPaid},
+		},
+	}}
+	handler := New(mockSvc)
+
+	router := gin.New()
+	router.GET("/api/order/:id/status", handler.GetOrderStatus)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/order/test-order-123/status", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "test-order-123", mockSvc.key)
+
+	var response models.StatusTimeline
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, models.StatusPaid, response.Status)
+	assert.Len(t, response.Timeline, 2)
+
+	mockSvc.err = service.ErrOrderNotFound
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/order/nonexistent/status", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
 func TestHealthCheck(t *testing.T) {
 	mockSvc := &mockService{}
 	handler := New(mockSvc)
@@ -118,4 +259,142 @@ func TestHealthCheck(t *testing.T) {
 	err = json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Equal(t, "healthy", response["status"])
-}
\ No newline at end of file
+}
+
+func TestListOrdersHandler(t *testing.T) {
+	mockSvc := &mockService{page: &service.OrderPage{
+		Orders:     []*models.Order{{OrderUID: "test-order-123"}},
+		NextCursor: "next",
+	}}
+	handler := New(mockSvc)
+
+	router := gin.New()
+	router.GET("/api/orders", handler.ListOrders)
+
+	req, err := http.NewRequest("GET", "/api/orders?customer_id=test&currency=USD&brand=Vivienne+Sabo"+
+		"&nm_id=2389212&date_from=2021-11-01&date_to=2021-12-01T00:00:00Z&limit=10&cursor=abc", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "test", mockSvc.filter.CustomerID)
+	assert.Equal(t, "USD", mockSvc.filter.Currency)
+	assert.Equal(t, "Vivienne Sabo", mockSvc.filter.Brand)
+	assert.Equal(t, 2389212, mockSvc.filter.NmID)
+	assert.Equal(t, 10, mockSvc.filter.Limit)
+	assert.Equal(t, "abc", mockSvc.filter.Cursor)
+	assert.Equal(t, time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC), mockSvc.filter.CreatedFrom)
+	assert.Equal(t, time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC), mockSvc.filter.CreatedTo)
+
+	var response service.OrderPage
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Orders, 1)
+	assert.Equal(t, "next", response.NextCursor)
+}
+
+func TestListOrdersHandlerDateOnlyTo(t *testing.T) {
+	mockSvc := &mockService{page: &service.OrderPage{}}
+	handler := New(mockSvc)
+
+	router := gin.New()
+	router.GET("/api/orders", handler.ListOrders)
+
+	req, err := http.NewRequest("GET", "/api/orders?date_from=2024-01-01&date_to=2024-01-02", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), mockSvc.filter.CreatedFrom)
+	assert.Equal(t, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), mockSvc.filter.CreatedTo)
+}
+
+func TestListOrdersHandlerBadRequest(t *testing.T) {
+	handler := New(&mockService{})
+
+	router := gin.New()
+	router.GET("/api/orders", handler.ListOrders)
+
+	for _, query := range []string{"date_from=yesterday", "nm_id=abc", "limit=-1"} {
+		req, err := http.NewRequest("GET", "/api/orders?"+query, nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+
+	handler = New(&mockService{err: service.ErrInvalidCursor})
+	router = gin.New()
+	router.GET("/api/orders", handler.ListOrders)
+
+	req, _ := http.NewRequest("GET", "/api/orders?cursor=broken", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLookupHandlers(t *testing.T) {
+	testOrder := &models.Order{OrderUID: "test-order-123"}
+	mockSvc := &mockService{order: testOrder, orders: []*models.Order{testOrder}}
+	handler := New(mockSvc)
+
+	router := gin.New()
+	router.GET("/api/orders/by-track/:track", handler.GetOrdersByTrackNumber)
+	router.GET("/api/orders/by-transaction/:transaction", handler.GetOrderByTransaction)
+	router.GET("/api/orders/by-rid/:rid", handler.GetOrderByRid)
+
+	tests := []struct {
+		path string
+		key  string
+	}{
+		{"/api/orders/by-transaction/b563feb7b2b84b6test", "b563feb7b2b84b6test"},
+		{"/api/orders/by-rid/ab4219087a764ae0btest", "ab4219087a764ae0btest"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code, tt.path)
+		assert.Equal(t, tt.key, mockSvc.key)
+
+		var response models.Order
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, testOrder.OrderUID, response.OrderUID)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/orders/by-track/WBILMTESTTRACK", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "WBILMTESTTRACK", mockSvc.key)
+
+	var response struct {
+		Orders []models.Order `json:"orders"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response.Orders, 1)
+}
+
+func TestLookupHandlersNotFound(t *testing.T) {
+	handler := New(&mockService{err: service.ErrOrderNotFound})
+
+	router := gin.New()
+	router.GET("/api/orders/by-track/:track", handler.GetOrdersByTrackNumber)
+	router.GET("/api/orders/by-rid/:rid", handler.GetOrderByRid)
+
+	for _, path := range []string{"/api/orders/by-track/UNKNOWN", "/api/orders/by-rid/unknown"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code, path)
+	}
+}
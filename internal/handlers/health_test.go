@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLive(t *testing.T) {
+	handler := New(&mockService{})
+
+	router := gin.New()
+	router.GET("/api/health/live", handler.Live)
+
+	req, _ := http.NewRequest("GET", "/api/health/live", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestReady(t *testing.T) {
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name   string
+		checks []Check
+		code   int
+		status string
+	}{
+		{"all up", []Check{{"postgres", up}, {"nats", up}}, http.StatusOK, "ready"},
+		{"one down", []Check{{"postgres", down}, {"nats", up}}, http.StatusServiceUnavailable, "degraded"},
+	}
+
+	for _, tt := range tests {
+		handler := New(&mockService{}, tt.checks...)
+
+		router := gin.New()
+		router.GET("/api/health/ready", handler.Ready)
+
+		req, _ := http.NewRequest("GET", "/api/health/ready", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, tt.code, rr.Code, tt.name)
+
+		var response struct {
+			Status       string                 `json:"status"`
+			Dependencies map[string]checkResult `json:"dependencies"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, tt.status, response.Status, tt.name)
+		assert.Len(t, response.Dependencies, len(tt.checks))
+		assert.Equal(t, "up", response.Dependencies["nats"].Status)
+	}
+}
+
+func TestReadyReportsError(t *testing.T) {
+	handler := New(&mockService{}, Check{
+		Name: "postgres",
+		Run:  func(ctx context.Context) error { return errors.New("connection refused") },
+	})
+
+	router := gin.New()
+	router.GET("/api/health/ready", handler.Ready)
+
+	req, _ := http.NewRequest("GET", "/api/health/ready", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var response struct {
+		Dependencies map[string]checkResult `json:"dependencies"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "down", response.Dependencies["postgres"].Status)
+	assert.Equal(t, "connection refused", response.Dependencies["postgres"].Error)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"order-service/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	handler := New(&mockService{order: &models.Order{OrderUID: "test-order-123"}})
+
+	router := gin.New()
+	router.Use(Metrics())
+	router.GET("/api/order/:id", handler.GetOrder)
+
+	req, _ := http.NewRequest("GET", "/api/order/test-order-123", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+
+	found := false
+	for _, family := range families {
+		if family.GetName() != "order_service_http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["route"] == "/api/order/:id" && labels["status"] == "200" && labels["method"] == "GET" {
+				found = metric.GetHistogram().GetSampleCount() > 0
+			}
+		}
+	}
+	assert.True(t, found)
+}
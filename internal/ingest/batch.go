@@ -0,0 +1,63 @@
+package ingest
+
+import (
+	"order-service/internal/service"
+	"order-service/internal/source"
+	"time"
+)
+
+// WithBatches makes every worker collect up to size messages, waiting at
+// most window after the first one, and store them in one transaction. The
+// messages are acked only after the commit. Without WithWorkers a single
+// worker is used.
+func WithBatches(size int, window time.Duration) Option {
+	return func(c *Consumer) {
+		c.batchSize = size
+		c.batchWindow = window
+	}
+}
+
+func (c *Consumer) workBatches(queue chan *source.Message) {
+	var batch []*source.Message
+	timer := time.NewTimer(c.batchWindow)
+	timer.Stop()
+
+	for {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				c.flush(batch)
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(c.batchWindow)
+			}
+			batch = append(batch, msg)
+			if len(batch) < c.batchSize {
+				continue
+			}
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		c.flush(batch)
+		batch = nil
+	}
+}
+
+func (c *Consumer) flush(batch []*source.Message) {
+	if len(batch) == 0 {
+		return
+	}
+
+	messages := make([]service.Message, len(batch))
+	for i, msg := range batch {
+		messages[i] = versioned(msg)
+	}
+
+	errs := c.service.ProcessBatch(messages)
+	for i, msg := range batch {
+		c.settle(msg, errs[i])
+		c.inflight.Done()
+	}
+}
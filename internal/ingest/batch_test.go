@@ -0,0 +1,50 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"order-service/internal/source"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchesAckAfterCommit(t *testing.T) {
+	svc := &mockService{}
+	src := source.NewMemory("memory")
+	consumer := New(svc, WithBatches(3, 10*time.Millisecond))
+	assert.NoError(t, src.Connect())
+	assert.NoError(t, src.Start(consumer.Handle))
+
+	src.Deliver("orders", []byte(`{"order_uid":"a"}`))
+	src.Deliver("orders", []byte(`{invalid json}`))
+	src.Deliver("orders", []byte(`{"order_uid":"b"}`))
+	src.Deliver("orders", []byte(`{"order_uid":"c"}`))
+
+	assert.Eventually(t, func() bool {
+		return len(src.Acked()) == 4
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, consumer.Drain(context.Background()))
+
+	svc.mu.Lock()
+	assert.Equal(t, []int{3, 1}, svc.batches)
+	assert.Len(t, svc.deadLetters, 1)
+	svc.mu.Unlock()
+}
+
+func TestBatchesNakOnDatabaseError(t *testing.T) {
+	svc := &mockService{err: errors.New("connection reset")}
+	src := source.NewMemory("memory")
+	consumer := New(svc, WithWorkers(2, 4), WithBatches(10, time.Millisecond))
+	assert.NoError(t, src.Connect())
+	assert.NoError(t, src.Start(consumer.Handle))
+
+	src.Deliver("orders", []byte(`{"order_uid":"a"}`))
+	src.Deliver("orders", []byte(`{"order_uid":"b"}`))
+
+	assert.NoError(t, consumer.Drain(context.Background()))
+	assert.Empty(t, src.Acked())
+	assert.Len(t, src.Naked(), 2)
+}
@@ -0,0 +1,198 @@
+// Package ingest feeds messages from the sources into the order service and
+// decides whether each one is acked, dead-lettered or redelivered.
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"order-service/internal/models"
+	"order-service/internal/service"
+	"order-service/internal/source"
+	"sync"
+	"time"
+)
+
+type Consumer struct {
+	service service.OrderService
+	queues  []chan *source.Message
+	apply   func(service.Message) error
+
+	batchSize   int
+	batchWindow time.Duration
+
+	// inflight tracks ProcessMessage calls so shutdown can drain them;
+	// draining is guarded by mu and rejects messages that race with it.
+	mu       sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+}
+
+type Option func(*Consumer)
+
+// WithWorkers processes messages on a pool of workers instead of the
+// delivering goroutine. Messages are sharded by order_uid, so updates of one
+// order are applied in delivery order. Handle blocks once the worker queue
+// is full, which together with the source's in-flight limit bounds memory.
+func WithWorkers(workers, queueSize int) Option {
+	return func(c *Consumer) {
+		for i := 0; i < workers; i++ {
+			c.queues = append(c.queues, make(chan *source.Message, queueSize))
+		}
+	}
+}
+
+// WithProcessor stores messages with process instead of ProcessMessage,
+// e.g. to consume status events. Batching does not apply to it.
+func WithProcessor(process func(service.Message) error) Option {
+	return func(c *Consumer) {
+		c.apply = process
+	}
+}
+
+func New(service service.OrderService, opts ...Option) *Consumer {
+	c := &Consumer{service: service}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.apply != nil {
+		c.batchSize = 0
+	}
+	if c.batchSize > 1 && len(c.queues) == 0 {
+		c.queues = append(c.queues, make(chan *source.Message, c.batchSize))
+	}
+	for _, queue := range c.queues {
+		go c.work(queue)
+	}
+	return c
+}
+
+// Handle acks a message once it is stored or moved to dead letters.
+// Transient failures are nacked so that the source redelivers them.
+func (c *Consumer) Handle(msg *source.Message) {
+	if !c.begin() {
+		return
+	}
+	if len(c.queues) == 0 {
+		defer c.inflight.Done()
+		c.process(msg)
+		return
+	}
+	c.queues[shard(msg.Data, len(c.queues))] <- msg
+}
+
+func (c *Consumer) work(queue chan *source.Message) {
+	if c.batchSize > 1 {
+		c.workBatches(queue)
+		return
+	}
+	for msg := range queue {
+		c.process(msg)
+		c.inflight.Done()
+	}
+}
+
+// shard picks the worker for a message by its order_uid. Payloads without
+// one are invalid anyway and go to the first worker.
+func shard(data []byte, workers int) int {
+	var key struct {
+		OrderUID string `json:"order_uid"`
+	}
+	if json.Unmarshal(data, &key) != nil || key.OrderUID == "" {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key.OrderUID))
+	return int(h.Sum32() % uint32(workers))
+}
+
+func (c *Consumer) process(msg *source.Message) {
+	if c.apply != nil {
+		c.settle(msg, c.apply(versioned(msg)))
+		return
+	}
+	c.settle(msg, c.service.ProcessMessage(versioned(msg)))
+}
+
+// versioned identifies the stream of a message by its source and subject,
+// the scope in which sequence numbers are ordered.
+func versioned(msg *source.Message) service.Message {
+	return service.Message{
+		Data:       msg.Data,
+		Stream:     msg.Source + "/" + msg.Subject,
+		Sequence:   msg.Sequence,
+		ReceivedAt: msg.Timestamp,
+	}
+}
+
+// settle acks processed messages and dead-letters invalid ones. Other
+// failures are nacked for redelivery, unless the source will not redeliver
+// the message again; then it is dead-lettered too instead of being lost.
+func (c *Consumer) settle(msg *source.Message, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrInvalidMessage) || msg.LastDelivery:
+		letter := &models.DeadLetter{
+			Channel:    msg.Subject,
+			Sequence:   msg.Sequence,
+			Reason:     err.Error(),
+			Payload:    msg.Data,
+			ReceivedAt: msg.Timestamp,
+		}
+		if err := c.service.DeadLetter(letter); err != nil {
+			log.Printf("Error dead-lettering message seq=%d, awaiting redelivery: %v", msg.Sequence, err)
+			msg.Nak()
+			return
+		}
+	default:
+		log.Printf("Error processing message seq=%d, awaiting redelivery: %v", msg.Sequence, err)
+		msg.Nak()
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		log.Printf("Failed to ack message seq=%d: %v", msg.Sequence, err)
+	}
+}
+
+// begin registers an in-flight message unless draining has started.
+// Messages refused here are not acked and will be redelivered.
+func (c *Consumer) begin() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.draining {
+		return false
+	}
+	c.inflight.Add(1)
+	return true
+}
+
+// Drain refuses new messages and waits for queued and in-flight ones until
+// ctx ends. Once drained the workers exit.
+func (c *Consumer) Drain(ctx context.Context) error {
+	c.mu.Lock()
+	c.draining = true
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		for _, queue := range c.queues {
+			close(queue)
+		}
+		c.queues = nil
+		log.Println("In-flight messages drained")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("in-flight messages not drained: %v", ctx.Err())
+	}
+}
@@ -0,0 +1,200 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"order-service/internal/models"
+	"order-service/internal/service"
+	"order-service/internal/source"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockService struct {
+	service.OrderService
+	mu            sync.Mutex
+	err           error
+	deadLetterErr error
+	processed     [][]byte
+	streams       []string
+	batches       []int
+	deadLetters   []*models.DeadLetter
+}
+
+func (m *mockService) ProcessMessage(msg service.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.processed = append(m.processed, msg.Data)
+	m.streams = append(m.streams, msg.Stream)
+	return m.err
+}
+
+func (m *mockService) ProcessBatch(batch []service.Message) []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches = append(m.batches, len(batch))
+	errs := make([]error, len(batch))
+	for i, msg := range batch {
+		m.processed = append(m.processed, msg.Data)
+		errs[i] = m.err
+		if !json.Valid(msg.Data) {
+			errs[i] = service.ErrInvalidMessage
+		}
+	}
+	return errs
+}
+
+func (m *mockService) DeadLetter(letter *models.DeadLetter) error {
+	if m.deadLetterErr != nil {
+		return m.deadLetterErr
+	}
+	m.deadLetters = append(m.deadLetters, letter)
+	return nil
+}
+
+func startConsumer(t *testing.T, svc *mockService) (*Consumer, *source.Memory) {
+	src := source.NewMemory("memory")
+	consumer := New(svc)
+	assert.NoError(t, src.Connect())
+	assert.NoError(t, src.Start(consumer.Handle))
+	return consumer, src
+}
+
+func TestHandleAcksProcessedMessage(t *testing.T) {
+	svc := &mockService{}
+	_, src := startConsumer(t, svc)
+
+	seq, err := src.Deliver("orders", []byte(`{"order_uid":"test-123"}`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []uint64{seq}, src.Acked())
+	assert.Empty(t, src.Naked())
+	assert.Len(t, svc.processed, 1)
+	assert.Equal(t, []string{"memory/orders"}, svc.streams)
+}
+
+func TestHandleDeadLettersInvalidMessage(t *testing.T) {
+	svc := &mockService{err: fmt.Errorf("%w: order_uid is required", service.ErrInvalidMessage)}
+	_, src := startConsumer(t, svc)
+
+	seq, _ := src.Deliver("orders", []byte(`{}`))
+
+	assert.Equal(t, []uint64{seq}, src.Acked())
+	assert.Len(t, svc.deadLetters, 1)
+	assert.Equal(t, "orders", svc.deadLetters[0].Channel)
+	assert.Equal(t, seq, svc.deadLetters[0].Sequence)
+	assert.Contains(t, svc.deadLetters[0].Reason, "order_uid is required")
+}
+
+func TestHandleNaksTransientFailures(t *testing.T) {
+	svc := &mockService{err: errors.New("connection refused")}
+	_, src := startConsumer(t, svc)
+
+	first, _ := src.Deliver("orders", []byte(`{}`))
+
+	svc.err = service.ErrInvalidMessage
+	svc.deadLetterErr = errors.New("connection refused")
+	second, _ := src.Deliver("orders", []byte(`{}`))
+
+	assert.Empty(t, src.Acked())
+	assert.Equal(t, []uint64{first, second}, src.Naked())
+}
+
+func TestSettleDeadLettersLastDelivery(t *testing.T) {
+	svc := &mockService{}
+	consumer := New(svc)
+
+	consumer.settle(&source.Message{Subject: "orders", Sequence: 9}, errors.New("connection refused"))
+	assert.Empty(t, svc.deadLetters)
+
+	consumer.settle(&source.Message{Subject: "orders", Sequence: 9, LastDelivery: true}, errors.New("connection refused"))
+	assert.Len(t, svc.deadLetters, 1)
+	assert.Equal(t, uint64(9), svc.deadLetters[0].Sequence)
+	assert.Equal(t, "connection refused", svc.deadLetters[0].Reason)
+}
+
+func TestProcessorReplacesProcessMessage(t *testing.T) {
+	svc := &mockService{}
+	var events []service.Message
+	consumer := New(svc, WithBatches(10, time.Second), WithProcessor(func(msg service.Message) error {
+		events = append(events, msg)
+		return nil
+	}))
+
+	src := source.NewMemory("memory")
+	assert.NoError(t, src.Connect())
+	assert.NoError(t, src.Start(consumer.Handle))
+
+	seq, _ := src.Deliver("order-status", []byte(`{"order_uid":"test-123","status":"paid"}`))
+
+	assert.Equal(t, []uint64{seq}, src.Acked())
+	assert.Empty(t, svc.processed)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "memory/order-status", events[0].Stream)
+}
+
+func TestDrainWaitsForInflightMessages(t *testing.T) {
+	svc := &mockService{}
+	consumer, src := startConsumer(t, svc)
+
+	assert.True(t, consumer.begin())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, consumer.Drain(ctx))
+	assert.False(t, consumer.begin())
+
+	consumer.inflight.Done()
+	assert.NoError(t, consumer.Drain(context.Background()))
+
+	src.Deliver("orders", []byte(`{}`))
+	assert.Empty(t, svc.processed)
+	assert.Empty(t, src.Acked())
+	assert.Empty(t, src.Naked())
+}
+
+func TestWorkersKeepOrderPerOrderUID(t *testing.T) {
+	svc := &mockService{}
+	src := source.NewMemory("memory")
+	consumer := New(svc, WithWorkers(4, 8))
+	assert.NoError(t, src.Connect())
+	assert.NoError(t, src.Start(consumer.Handle))
+
+	uids := []string{"a", "b", "c", "d", "e"}
+	for i := 0; i < 20; i++ {
+		for _, uid := range uids {
+			src.Deliver("orders", []byte(fmt.Sprintf(`{"order_uid":%q,"n":%d}`, uid, i)))
+		}
+	}
+	src.Deliver("orders", []byte(`{invalid json}`))
+
+	assert.NoError(t, consumer.Drain(context.Background()))
+	assert.Len(t, src.Acked(), 101)
+
+	next := map[string]int{}
+	for _, data := range svc.processed {
+		var msg struct {
+			OrderUID string `json:"order_uid"`
+			N        int    `json:"n"`
+		}
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		assert.Equal(t, next[msg.OrderUID], msg.N, msg.OrderUID)
+		next[msg.OrderUID]++
+	}
+	assert.Len(t, next, len(uids))
+}
+
+func TestShard(t *testing.T) {
+	a := shard([]byte(`{"order_uid":"a"}`), 8)
+	assert.Equal(t, a, shard([]byte(`{"order_uid":"a","track_number":"x"}`), 8))
+	assert.Equal(t, 0, shard([]byte(`{invalid json}`), 8))
+	assert.Equal(t, 0, shard([]byte(`{"order_uid":"a"}`), 1))
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"order-service/internal/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "order_service"
+
+// Failure reasons used as the "reason" label of MessagesFailed.
+const (
+	ReasonInvalidJSON = "invalid_json"
+	ReasonValidation  = "validation"
+	ReasonConsistency = "consistency"
+	ReasonDatabase    = "database"
+	ReasonTransition  = "transition"
+)
+
+// Reasons used as the "reason" label of MessagesSkipped.
+const (
+	SkipDuplicate = "duplicate"
+	SkipStale     = "stale"
+)
+
+// Reasons used as the "reason" label of CacheInvalidations.
+const (
+	InvalidateChange    = "change"
+	InvalidateReconnect = "reconnect"
+)
+
+var (
+	MessagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Messages received from the broker.",
+	})
+
+	MessagesProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_processed_total",
+		Help:      "Messages stored successfully.",
+	})
+
+	MessagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_failed_total",
+		Help:      "Messages that failed processing, by reason.",
+	}, []string{"reason"})
+
+	MessagesSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_skipped_total",
+		Help:      "Messages acked without changes because the stored order is the same or newer.",
+	}, []string{"reason"})
+
+	StatusTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_transitions_total",
+		Help:      "Order status changes applied, by previous and new status.",
+	}, []string{"from", "to"})
+
+	SaveOrderDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "save_order_duration_seconds",
+		Help:      "Duration of the saveOrder database transaction.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	SaveBatchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "save_batch_duration_seconds",
+		Help:      "Duration of the database transaction of a message batch.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	RestoreDuration = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_restore_duration_seconds",
+		Help:      "Duration of the last cache restore from the database.",
+	})
+
+	RestoredOrders = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_restored_orders",
+		Help:      "Orders loaded by the last cache restore.",
+	})
+
+	SourceConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "source_connected",
+		Help:      "1 while the connection of a message source is up.",
+	}, []string{"source"})
+
+	SourceConnectionTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "source_connection_transitions_total",
+		Help:      "Message source connection state changes, by new state.",
+	}, []string{"source", "state"})
+
+	CacheInvalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_invalidations_total",
+		Help:      "Cached orders dropped after a change notification, or whole cache drops after a listener reconnect.",
+	}, []string{"reason"})
+
+	OutboxPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_published_total",
+		Help:      "Outbox events published and removed from the outbox.",
+	})
+
+	OutboxFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_failures_total",
+		Help:      "Outbox relay passes that failed and will be retried.",
+	})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+type cacheCollector struct {
+	cache       *cache.Cache
+	hits        *prometheus.Desc
+	misses      *prometheus.Desc
+	evictions   *prometheus.Desc
+	expirations *prometheus.Desc
+	refused     *prometheus.Desc
+	entries     *prometheus.Desc
+	bytes       *prometheus.Desc
+}
+
+// RegisterCache exposes the cache statistics. The cache keeps its own
+// counters, so they are read on scrape rather than mirrored.
+func RegisterCache(reg prometheus.Registerer, c *cache.Cache) error {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", name), help, nil, nil)
+	}
+	return reg.Register(&cacheCollector{
+		cache:       c,
+		hits:        desc("hits_total", "Cache lookups that found an order."),
+		misses:      desc("misses_total", "Cache lookups that found nothing."),
+		evictions:   desc("evictions_total", "Orders evicted to respect the cache limits."),
+		expirations: desc("expirations_total", "Orders dropped after their TTL."),
+		refused:     desc("refused_loads_total", "Orders read from the database but not cached, since they changed meanwhile."),
+		entries:     desc("entries", "Orders currently cached."),
+		bytes:       desc("bytes", "Approximate memory held by cached orders."),
+	})
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.expirations
+	ch <- c.refused
+	ch <- c.entries
+	ch <- c.bytes
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.expirations, prometheus.CounterValue, float64(stats.Expirations))
+	ch <- prometheus.MustNewConstMetric(c.refused, prometheus.CounterValue, float64(stats.RefusedLoads))
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Entries))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(stats.Bytes))
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"order-service/internal/cache"
+	"order-service/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheCollector(t *testing.T) {
+	c := cache.NewWithOptions(cache.Options{MaxEntries: 1})
+	c.Set("order1", &models.Order{OrderUID: "order1"})
+	c.Set("order2", &models.Order{OrderUID: "order2"})
+	c.Get("order1")
+	c.Get("order2")
+
+	reg := prometheus.NewRegistry()
+	assert.NoError(t, RegisterCache(reg, c))
+
+	expected := `
+# HELP order_service_cache_entries Orders currently cached.
+# TYPE order_service_cache_entries gauge
+order_service_cache_entries 1
+# HELP order_service_cache_evictions_total Orders evicted to respect the cache limits.
+# TYPE order_service_cache_evictions_total counter
+order_service_cache_evictions_total 1
+# HELP order_service_cache_hits_total Cache lookups that found an order.
+# TYPE order_service_cache_hits_total counter
+order_service_cache_hits_total 1
+# HELP order_service_cache_misses_total Cache lookups that found nothing.
+# TYPE order_service_cache_misses_total counter
+order_service_cache_misses_total 1
+`
+	err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"order_service_cache_entries", "order_service_cache_evictions_total",
+		"order_service_cache_hits_total", "order_service_cache_misses_total")
+	assert.NoError(t, err)
+}
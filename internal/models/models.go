@@ -1,24 +1,30 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
 type Order struct {
-	OrderUID          string    `json:"order_uid" db:"order_uid"`
-	TrackNumber       string    `json:"track_number" db:"track_number"`
-	Entry             string    `json:"entry" db:"entry"`
-	Delivery          Delivery  `json:"delivery" db:"-"`
-	Payment           Payment   `json:"payment" db:"-"`
-	Items             []Item    `json:"items" db:"-"`
-	Locale            string    `json:"locale" db:"locale"`
-	InternalSignature string    `json:"internal_signature" db:"internal_signature"`
-	CustomerID        string    `json:"customer_id" db:"customer_id"`
-	DeliveryService   string    `json:"delivery_service" db:"delivery_service"`
-	Shardkey          string    `json:"shardkey" db:"shardkey"`
-	SmID              int       `json:"sm_id" db:"sm_id"`
-	DateCreated       time.Time `json:"date_created" db:"date_created"`
-	OofShard          string    `json:"oof_shard" db:"oof_shard"`
+	OrderUID          string          `json:"order_uid" db:"order_uid"`
+	TrackNumber       string          `json:"track_number" db:"track_number"`
+	Entry             string          `json:"entry" db:"entry"`
+	Delivery          Delivery        `json:"delivery" db:"-"`
+	Payment           Payment         `json:"payment" db:"-"`
+	Items             []Item          `json:"items" db:"-"`
+	Locale            string          `json:"locale" db:"locale"`
+	InternalSignature string          `json:"internal_signature" db:"internal_signature"`
+	CustomerID        string          `json:"customer_id" db:"customer_id"`
+	DeliveryService   string          `json:"delivery_service" db:"delivery_service"`
+	Shardkey          string          `json:"shardkey" db:"shardkey"`
+	SmID              int             `json:"sm_id" db:"sm_id"`
+	DateCreated       time.Time       `json:"date_created" db:"date_created"`
+	OofShard          string          `json:"oof_shard" db:"oof_shard"`
+	Violations        []RuleViolation `json:"violations,omitempty" db:"violations"`
+	// Position and hash of the message the order was stored from.
+	SourceStream string `json:"-" db:"source_stream"`
+	SourceSeq    uint64 `json:"-" db:"source_seq"`
+	PayloadHash  string `json:"-" db:"payload_hash"`
 }
 
 type Delivery struct {
@@ -61,4 +67,55 @@ type Item struct {
 	NmID        int    `json:"nm_id" db:"nm_id"`
 	Brand       string `json:"brand" db:"brand"`
 	Status      int    `json:"status" db:"status"`
-}
\ No newline at end of file
+}
+
+type DeadLetter struct {
+	ID         int64     `json:"-" db:"id"`
+	Channel    string    `json:"channel" db:"channel"`
+	Sequence   uint64    `json:"sequence" db:"sequence"`
+	Reason     string    `json:"reason" db:"reason"`
+	Payload    []byte    `json:"payload" db:"payload"`
+	ReceivedAt time.Time `json:"received_at" db:"received_at"`
+}
+
+type RuleViolation struct {
+	Rule    string `json:"rule"`
+	Action  string `json:"action"`
+	Message string `json:"message"`
+}
+
+// OrderVersion is a stored message of an order. Diff maps changed JSON paths
+// to their old and new values and is empty for the first version.
+type OrderVersion struct {
+	ID           int64                  `json:"id" db:"id"`
+	OrderUID     string                 `json:"order_uid" db:"order_uid"`
+	SourceStream string                 `json:"source_stream" db:"source_stream"`
+	SourceSeq    uint64                 `json:"source_seq" db:"source_seq"`
+	Payload      json.RawMessage        `json:"payload" db:"payload"`
+	Diff         map[string]FieldChange `json:"diff,omitempty" db:"diff"`
+	ReceivedAt   time.Time              `json:"received_at" db:"received_at"`
+	RecordedAt   time.Time              `json:"recorded_at" db:"recorded_at"`
+}
+
+// FieldChange holds the old and new value of a JSON path; a missing side
+// means the path was added or removed.
+type FieldChange struct {
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// Types of OrderEvent, also used as the subjects the events are published to.
+const (
+	EventOrderCreated = "order.created"
+	EventOrderUpdated = "order.updated"
+)
+
+// OrderEvent tells downstream services that an order was stored.
+type OrderEvent struct {
+	Type         string    `json:"type"`
+	OrderUID     string    `json:"order_uid"`
+	SourceStream string    `json:"source_stream"`
+	SourceSeq    uint64    `json:"source_seq"`
+	OccurredAt   time.Time `json:"occurred_at"`
+	Order        *Order    `json:"order"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// OrderStatus is the lifecycle stage of an order as a whole, unlike
+// Item.Status which is the code reported by the delivery service.
+type OrderStatus string
+
+const (
+	StatusCreated    OrderStatus = "created"
+	StatusPaid       OrderStatus = "paid"
+	StatusAssembling OrderStatus = "assembling"
+	StatusShipped    OrderStatus = "shipped"
+	StatusDelivered  OrderStatus = "delivered"
+	StatusCancelled  OrderStatus = "cancelled"
+	StatusReturned   OrderStatus = "returned"
+)
+
+// transitions lists the statuses each status may change to. Cancelled and
+// returned orders are final.
+var transitions = map[OrderStatus][]OrderStatus{
+	StatusCreated:    {StatusPaid, StatusCancelled},
+	StatusPaid:       {StatusAssembling, StatusCancelled},
+	StatusAssembling: {StatusShipped, StatusCancelled},
+	StatusShipped:    {StatusDelivered, StatusReturned},
+	StatusDelivered:  {StatusReturned},
+	StatusCancelled:  nil,
+	StatusReturned:   nil,
+}
+
+func (s OrderStatus) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// CanTransition reports whether an order may change from s to next directly.
+func (s OrderStatus) CanTransition(next OrderStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Precedes reports whether next is reachable from s in one or more
+// transitions, i.e. s is an earlier stage of the same lifecycle.
+func (s OrderStatus) Precedes(next OrderStatus) bool {
+	seen := map[OrderStatus]bool{s: true}
+	queue := []OrderStatus{s}
+	for len(queue) > 0 {
+		for _, status := range transitions[queue[0]] {
+			if status == next {
+				return true
+			}
+			if !seen[status] {
+				seen[status] = true
+				queue = append(queue, status)
+			}
+		}
+		queue = queue[1:]
+	}
+	return false
+}
+
+// StatusEvent is a status change published on the status channel.
+// ChangedAt defaults to the time the event was received.
+type StatusEvent struct {
+	OrderUID  string      `json:"order_uid"`
+	Status    OrderStatus `json:"status"`
+	ChangedAt time.Time   `json:"changed_at"`
+}
+
+type StatusTransition struct {
+	From       OrderStatus `json:"from,omitempty"`
+	To         OrderStatus `json:"to"`
+	ChangedAt  time.Time   `json:"changed_at"`
+	RecordedAt time.Time   `json:"recorded_at,omitempty"`
+}
+
+// StatusTimeline is the current status of an order and how it got there,
+// starting with its creation.
+type StatusTimeline struct {
+	OrderUID string             `json:"order_uid"`
+	Status   OrderStatus        `json:"status"`
+	Timeline []StatusTransition `json:"timeline"`
+}
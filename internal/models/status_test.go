@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderStatusTransitions(t *testing.T) {
+	assert.True(t, StatusCreated.Valid())
+	assert.False(t, OrderStatus("lost").Valid())
+
+	assert.True(t, StatusCreated.CanTransition(StatusPaid))
+	assert.True(t, StatusAssembling.CanTransition(StatusCancelled))
+	assert.True(t, StatusDelivered.CanTransition(StatusReturned))
+	assert.False(t, StatusCreated.CanTransition(StatusShipped))
+	assert.False(t, StatusShipped.CanTransition(StatusCancelled))
+	assert.False(t, StatusCancelled.CanTransition(StatusPaid))
+	assert.False(t, StatusPaid.CanTransition(StatusPaid))
+}
+
+func TestOrderStatusPrecedes(t *testing.T) {
+	assert.True(t, StatusCreated.Precedes(StatusDelivered))
+	assert.True(t, StatusPaid.Precedes(StatusReturned))
+	assert.False(t, StatusDelivered.Precedes(StatusPaid))
+	assert.False(t, StatusCancelled.Precedes(StatusShipped))
+	assert.False(t, StatusShipped.Precedes(StatusShipped))
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	emailPattern    = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	phonePattern    = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, e := range v {
+		messages[i] = e.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+type validator struct {
+	errors ValidationErrors
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// str checks a string column; maxLen mirrors the VARCHAR size in migrations,
+// zero means the column is TEXT.
+func (v *validator) str(field, value string, required bool, maxLen int) bool {
+	if value == "" {
+		if required {
+			v.add(field, "is required")
+		}
+		return false
+	}
+	if maxLen > 0 && utf8.RuneCountInString(value) > maxLen {
+		v.add(field, "must be at most %d characters", maxLen)
+		return false
+	}
+	return true
+}
+
+func (v *validator) nonNegative(field string, value int64) {
+	if value < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+func (v *validator) match(field, value string, pattern *regexp.Regexp, what string) {
+	if !pattern.MatchString(value) {
+		v.add(field, "is not a valid %s", what)
+	}
+}
+
+// Validate checks the order against the database schema and returns
+// ValidationErrors listing every offending field, or nil.
+func (o *Order) Validate() error {
+	v := &validator{}
+
+	v.str("order_uid", o.OrderUID, true, 50)
+	v.str("track_number", o.TrackNumber, true, 50)
+	v.str("entry", o.Entry, true, 10)
+	v.str("locale", o.Locale, true, 5)
+	v.str("internal_signature", o.InternalSignature, false, 255)
+	v.str("customer_id", o.CustomerID, true, 50)
+	v.str("delivery_service", o.DeliveryService, true, 50)
+	v.str("shardkey", o.Shardkey, true, 10)
+	v.str("oof_shard", o.OofShard, true, 10)
+	v.nonNegative("sm_id", int64(o.SmID))
+	if o.DateCreated.IsZero() {
+		v.add("date_created", "is required")
+	}
+
+	o.Delivery.validate(v, "delivery")
+	o.Payment.validate(v, "payment")
+
+	if len(o.Items) == 0 {
+		v.add("items", "must contain at least one item")
+	}
+	for i := range o.Items {
+		o.Items[i].validate(v, fmt.Sprintf("items[%d]", i))
+	}
+
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+func (d *Delivery) validate(v *validator, prefix string) {
+	v.str(prefix+".name", d.Name, true, 100)
+	if v.str(prefix+".phone", d.Phone, true, 20) {
+		v.match(prefix+".phone", d.Phone, phonePattern, "phone number")
+	}
+	v.str(prefix+".zip", d.Zip, true, 20)
+	v.str(prefix+".city", d.City, true, 100)
+	v.str(prefix+".address", d.Address, true, 0)
+	v.str(prefix+".region", d.Region, true, 100)
+	if v.str(prefix+".email", d.Email, true, 100) {
+		v.match(prefix+".email", d.Email, emailPattern, "email address")
+	}
+}
+
+func (p *Payment) validate(v *validator, prefix string) {
+	v.str(prefix+".transaction", p.Transaction, true, 50)
+	v.str(prefix+".request_id", p.RequestID, false, 50)
+	if v.str(prefix+".currency", p.Currency, true, 10) {
+		v.match(prefix+".currency", p.Currency, currencyPattern, "ISO 4217 currency code")
+	}
+	v.str(prefix+".provider", p.Provider, true, 50)
+	v.str(prefix+".bank", p.Bank, true, 50)
+	v.nonNegative(prefix+".amount", int64(p.Amount))
+	v.nonNegative(prefix+".payment_dt", p.PaymentDt)
+	v.nonNegative(prefix+".delivery_cost", int64(p.DeliveryCost))
+	v.nonNegative(prefix+".goods_total", int64(p.GoodsTotal))
+	v.nonNegative(prefix+".custom_fee", int64(p.CustomFee))
+}
+
+func (i *Item) validate(v *validator, prefix string) {
+	v.nonNegative(prefix+".chrt_id", int64(i.ChrtID))
+	v.str(prefix+".track_number", i.TrackNumber, true, 50)
+	v.nonNegative(prefix+".price", int64(i.Price))
+	v.str(prefix+".rid", i.Rid, true, 50)
+	v.str(prefix+".name", i.Name, true, 255)
+	if i.Sale < 0 || i.Sale > 100 {
+		v.add(prefix+".sale", "must be between 0 and 100")
+	}
+	v.str(prefix+".size", i.Size, true, 10)
+	v.nonNegative(prefix+".total_price", int64(i.TotalPrice))
+	v.nonNegative(prefix+".nm_id", int64(i.NmID))
+	v.str(prefix+".brand", i.Brand, true, 100)
+	v.nonNegative(prefix+".status", int64(i.Status))
+}
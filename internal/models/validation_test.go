@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validOrder() Order {
+	return Order{
+		OrderUID:        "b563feb7b2b84b6test",
+		TrackNumber:     "WBILMTESTTRACK",
+		Entry:           "WBIL",
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Now(),
+		OofShard:        "1",
+		Delivery: Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDt:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []Item{
+			{
+				ChrtID:      9934930,
+				TrackNumber: "WBILMTESTTRACK",
+				Price:       453,
+				Rid:         "ab4219087a764ae0btest",
+				Name:        "Mascaras",
+				Sale:        30,
+				Size:        "0",
+				TotalPrice:  317,
+				NmID:        2389212,
+				Brand:       "Vivienne Sabo",
+				Status:      202,
+			},
+		},
+	}
+}
+
+func fields(err error) []string {
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+	result := make([]string, len(verrs))
+	for i, e := range verrs {
+		result[i] = e.Field
+	}
+	return result
+}
+
+func TestValidateValidOrder(t *testing.T) {
+	order := validOrder()
+	assert.NoError(t, order.Validate())
+}
+
+func TestValidateRequiredFields(t *testing.T) {
+	order := validOrder()
+	order.OrderUID = ""
+	order.Delivery = Delivery{}
+	order.Payment.Transaction = ""
+	order.Items = nil
+
+	err := order.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "order_uid is required")
+
+	got := fields(err)
+	assert.Contains(t, got, "order_uid")
+	assert.Contains(t, got, "delivery.name")
+	assert.Contains(t, got, "delivery.email")
+	assert.Contains(t, got, "payment.transaction")
+	assert.Contains(t, got, "items")
+}
+
+func TestValidateLengths(t *testing.T) {
+	order := validOrder()
+	order.Entry = strings.Repeat("E", 11)
+	order.Items[0].Size = strings.Repeat("X", 11)
+	order.Delivery.Name = strings.Repeat("Я", 100)
+
+	err := order.Validate()
+	assert.Equal(t, []string{"entry", "items[0].size"}, fields(err))
+}
+
+func TestValidateFormats(t *testing.T) {
+	order := validOrder()
+	order.Delivery.Email = "not-an-email"
+	order.Delivery.Phone = "call me"
+	order.Payment.Currency = "usd"
+
+	err := order.Validate()
+	assert.Equal(t, []string{"delivery.phone", "delivery.email", "payment.currency"}, fields(err))
+}
+
+func TestValidateAmounts(t *testing.T) {
+	order := validOrder()
+	order.Payment.Amount = -1
+	order.Payment.CustomFee = -5
+	order.Items[0].Price = -10
+	order.Items[0].Sale = 101
+
+	err := order.Validate()
+	assert.Equal(t, []string{"payment.amount", "payment.custom_fee", "items[0].price", "items[0].sale"}, fields(err))
+}
@@ -0,0 +1,185 @@
+// Package outbox publishes the events that the order service writes to the
+// outbox table in the same transaction as the order. An event is removed
+// only after it was published, so a crash between the two publishes it
+// again: delivery is at least once and consumers must tolerate duplicates.
+// Only one replica relays at a time, so events are published in the order
+// they were written.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"order-service/internal/metrics"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// lockKey is the advisory lock held by the relaying replica.
+const lockKey = 0x6f7574626f78 // "outbox"
+
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+type Relay struct {
+	db        *sql.DB
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+type Option func(*Relay)
+
+// WithInterval sets how often the outbox is polled; a backlog is drained
+// without waiting between batches.
+func WithInterval(interval time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = interval
+	}
+}
+
+// WithBatchSize limits the events published per transaction.
+func WithBatchSize(size int) Option {
+	return func(r *Relay) {
+		r.batchSize = size
+	}
+}
+
+func New(db *sql.DB, publisher Publisher, opts ...Option) *Relay {
+	r := &Relay{
+		db:        db,
+		publisher: publisher,
+		interval:  time.Second,
+		batchSize: 100,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *Relay) Start() {
+	go r.run()
+}
+
+// Stop waits for the current batch to finish. Unpublished events stay in
+// the outbox for the next start.
+func (r *Relay) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+func (r *Relay) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			n, err := r.Relay()
+			if err != nil {
+				metrics.OutboxFailures.Inc()
+				log.Printf("Outbox relay failed, retrying in %s: %v", r.interval, err)
+				break
+			}
+			if n < r.batchSize || r.stopped() {
+				break
+			}
+		}
+	}
+}
+
+func (r *Relay) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Relay publishes the oldest pending events in order and removes them. It
+// stops at the first event that fails to publish so that the order of
+// events is kept, and returns how many were published. The transaction
+// holds an advisory lock; while another replica holds it, Relay does
+// nothing.
+func (r *Relay) Relay() (int, error) {
+	ctx := context.Background()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, lockKey).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("failed to lock outbox: %v", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, subject, payload FROM outbox
+		ORDER BY id LIMIT $1`, r.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load outbox: %v", err)
+	}
+
+	type event struct {
+		id      int64
+		subject string
+		payload []byte
+	}
+	var events []event
+	for rows.Next() {
+		var e event
+		if err := rows.Scan(&e.id, &e.subject, &e.payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox: %v", err)
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to load outbox: %v", err)
+	}
+
+	var published []int64
+	var publishErr error
+	for _, e := range events {
+		if err := r.publisher.Publish(e.subject, e.payload); err != nil {
+			publishErr = fmt.Errorf("failed to publish outbox event %d to %s: %v", e.id, e.subject, err)
+			break
+		}
+		published = append(published, e.id)
+	}
+
+	if len(published) > 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE id = ANY($1)`, pq.Array(published)); err != nil {
+			return 0, fmt.Errorf("failed to remove published events: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to remove published events: %v", err)
+		}
+		metrics.OutboxPublished.Add(float64(len(published)))
+	}
+	return len(published), publishErr
+}
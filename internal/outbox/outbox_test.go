@@ -0,0 +1,150 @@
+package outbox
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPublisher struct {
+	mu        sync.Mutex
+	subjects  []string
+	failAfter int
+}
+
+func (p *mockPublisher) Publish(subject string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failAfter >= 0 && len(p.subjects) >= p.failAfter {
+		return errors.New("connection refused")
+	}
+	p.subjects = append(p.subjects, subject)
+	return nil
+}
+
+func (p *mockPublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.subjects...)
+}
+
+func outboxRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "subject", "payload"}).
+		AddRow(1, "order.created", []byte(`{"order_uid":"a"}`)).
+		AddRow(2, "order.updated", []byte(`{"order_uid":"a"}`)).
+		AddRow(3, "order.created", []byte(`{"order_uid":"b"}`))
+}
+
+func expectLock(mock sqlmock.Sqlmock, locked bool) {
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").
+		WithArgs(lockKey).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(locked))
+}
+
+func TestRelayPublishesAndRemoves(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	publisher := &mockPublisher{failAfter: -1}
+	relay := New(db, publisher, WithBatchSize(10))
+
+	mock.ExpectBegin()
+	expectLock(mock, true)
+	mock.ExpectQuery("SELECT id, subject, payload FROM outbox ORDER BY id LIMIT \\$1").
+		WithArgs(10).
+		WillReturnRows(outboxRows())
+	mock.ExpectExec("DELETE FROM outbox WHERE id = ANY").
+		WithArgs(pq.Array([]int64{1, 2, 3})).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	n, err := relay.Relay()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"order.created", "order.updated", "order.created"}, publisher.published())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayKeepsEventsAfterPublishFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	publisher := &mockPublisher{failAfter: 1}
+	relay := New(db, publisher)
+
+	mock.ExpectBegin()
+	expectLock(mock, true)
+	mock.ExpectQuery("FROM outbox").WillReturnRows(outboxRows())
+	mock.ExpectExec("DELETE FROM outbox").
+		WithArgs(pq.Array([]int64{1})).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := relay.Relay()
+	assert.Error(t, err)
+	assert.Equal(t, 1, n)
+
+	// Nothing published: the transaction is rolled back and the events stay.
+	publisher.failAfter = 0
+	publisher.subjects = nil
+	mock.ExpectBegin()
+	expectLock(mock, true)
+	mock.ExpectQuery("FROM outbox").WillReturnRows(outboxRows())
+	mock.ExpectRollback()
+
+	n, err = relay.Relay()
+	assert.Error(t, err)
+	assert.Zero(t, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelaySkipsWhileAnotherReplicaRelays(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	publisher := &mockPublisher{failAfter: -1}
+	relay := New(db, publisher)
+
+	mock.ExpectBegin()
+	expectLock(mock, false)
+	mock.ExpectRollback()
+
+	n, err := relay.Relay()
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, publisher.published())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayRunsUntilStopped(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	publisher := &mockPublisher{failAfter: -1}
+	relay := New(db, publisher, WithInterval(time.Millisecond), WithBatchSize(3))
+
+	// A full batch is followed by another pass without waiting.
+	mock.ExpectBegin()
+	expectLock(mock, true)
+	mock.ExpectQuery("FROM outbox").WillReturnRows(outboxRows())
+	mock.ExpectExec("DELETE FROM outbox").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	expectLock(mock, true)
+	mock.ExpectQuery("FROM outbox").WillReturnRows(sqlmock.NewRows([]string{"id", "subject", "payload"}))
+	mock.ExpectRollback()
+
+	relay.Start()
+	assert.Eventually(t, func() bool { return len(publisher.published()) == 3 }, time.Second, time.Millisecond)
+	relay.Stop()
+	relay.Stop()
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"order-service/internal/metrics"
+	"order-service/internal/models"
+	"time"
+)
+
+// ProcessBatch stores several messages in one transaction and returns an
+// error per message. Invalid messages fail on their own; when the database
+// rejects the batch, its orders are saved one by one so that only the
+// offending ones fail. Within the batch a newer
+// message for the same order_uid supersedes an older one, as it would when
+// the messages were processed one by one; stale and duplicate messages are
+// skipped without an error.
+func (s *orderService) ProcessBatch(batch []Message) []error {
+	errs := make([]error, len(batch))
+
+	var pending []received
+	var positions []int
+	byUID := make(map[string]*models.Order)
+	skips := 0
+	for i, msg := range batch {
+		metrics.MessagesReceived.Inc()
+
+		order, err := s.prepare(msg)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if reason := s.superseded(order); reason != "" {
+			skipped(order, reason)
+			skips++
+			continue
+		}
+		if prev, ok := byUID[order.OrderUID]; ok && !newer(order, prev) {
+			skipped(order, metrics.SkipStale)
+			skips++
+			continue
+		}
+
+		byUID[order.OrderUID] = order
+		pending = append(pending, received{order: order, msg: msg})
+		positions = append(positions, i)
+	}
+	if len(pending) == 0 {
+		return errs
+	}
+
+	started := time.Now()
+	saved, err := s.saveOrders(pending)
+	metrics.SaveBatchDuration.Observe(time.Since(started).Seconds())
+	if err != nil && len(pending) == 1 {
+		errs[positions[0]] = failed(metrics.ReasonDatabase, fmt.Errorf("failed to save order: %v", err))
+		return errs
+	}
+	if err != nil {
+		log.Printf("Batch of %d orders failed, saving them one by one: %v", len(pending), err)
+		saved = s.saveEach(pending, positions, errs)
+	}
+
+	written := make(map[string]bool, len(saved))
+	for _, order := range saved {
+		s.cache.Set(order.OrderUID, order)
+		written[order.OrderUID] = true
+	}
+	for j, r := range pending {
+		if errs[positions[j]] == nil && !written[r.order.OrderUID] {
+			skipped(r.order, metrics.SkipStale)
+			skips++
+		}
+	}
+	processed := -skips
+	for _, err := range errs {
+		if err == nil {
+			processed++
+		}
+	}
+	metrics.MessagesProcessed.Add(float64(processed))
+	log.Printf("Batch of %d messages processed, %d orders saved", len(batch), len(saved))
+	return errs
+}
+
+// saveEach saves the orders of a rejected batch in their own transactions
+// and records the error of each order that fails again.
+func (s *orderService) saveEach(pending []received, positions []int, errs []error) []*models.Order {
+	var saved []*models.Order
+	for j := range pending {
+		started := time.Now()
+		one, err := s.saveOrders(pending[j : j+1])
+		metrics.SaveOrderDuration.Observe(time.Since(started).Seconds())
+		if err != nil {
+			errs[positions[j]] = failed(metrics.ReasonDatabase, fmt.Errorf("failed to save order: %v", err))
+			continue
+		}
+		saved = append(saved, one...)
+	}
+	return saved
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"order-service/internal/cache"
+	"order-service/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// anyArgs matches n arbitrary arguments followed by the given ones.
+func anyArgs(n int, then ...driver.Value) []driver.Value {
+	args := make([]driver.Value, n, n+len(then))
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	return append(args, then...)
+}
+
+func TestProcessBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	first := testOrder()
+	updated := testOrder()
+	updated.TrackNumber = "TRACK456"
+	other := testOrder()
+	other.OrderUID = "test-456"
+	other.Payment.Transaction = "other-transaction"
+
+	batch := make([]Message, 0, 5)
+	for i, order := range []interface{}{first, "invalid", updated, other, first} {
+		data, _ := json.Marshal(order)
+		batch = append(batch, Message{Data: data, Stream: "stan/orders", Sequence: uint64(i + 1)})
+	}
+	// A redelivery of the first message is older than the update.
+	batch[4].Sequence = 1
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO orders").WithArgs(anyArgs(2 * 15)...).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "inserted"}).
+			AddRow(first.OrderUID, false).
+			AddRow(other.OrderUID, true))
+	expectHistory(mock)
+	mock.ExpectExec("INSERT INTO delivery").WithArgs(anyArgs(2 * 8)...).WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec("INSERT INTO payment").WithArgs(anyArgs(2 * 11)...).WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec("DELETE FROM items").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO items").WithArgs(anyArgs(2 * 12)...).WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec("INSERT INTO outbox").
+		WithArgs(models.EventOrderUpdated, first.OrderUID, sqlmock.AnyArg(),
+			models.EventOrderCreated, other.OrderUID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectCommit()
+
+	errs := service.ProcessBatch(batch)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Len(t, errs, 5)
+	assert.NoError(t, errs[0])
+	assert.True(t, errors.Is(errs[1], ErrInvalidMessage))
+	assert.NoError(t, errs[2])
+	assert.NoError(t, errs[3])
+	assert.NoError(t, errs[4])
+
+	cached, ok := cache.Get(first.OrderUID)
+	assert.True(t, ok)
+	assert.Equal(t, "TRACK456", cached.TrackNumber)
+	_, ok = cache.Get(other.OrderUID)
+	assert.True(t, ok)
+}
+
+func TestProcessBatch_DatabaseError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	data, _ := json.Marshal(testOrder())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO orders").WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	errs := service.ProcessBatch([]Message{{Data: data}, {Data: []byte(`{invalid json}`)}})
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Error(t, errs[0])
+	assert.False(t, errors.Is(errs[0], ErrInvalidMessage))
+	assert.True(t, errors.Is(errs[1], ErrInvalidMessage))
+	assert.Equal(t, 0, cache.Size())
+}
+
+func TestProcessBatch_FallsBackToSingleOrders(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	poison := testOrder()
+	poison.OrderUID = "test-poison"
+	poison.Payment.Transaction = "poison-transaction"
+	order := testOrder()
+	batch := make([]Message, 0, 2)
+	for _, o := range []models.Order{poison, order} {
+		data, _ := json.Marshal(o)
+		batch = append(batch, Message{Data: data})
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO orders").WillReturnError(errors.New("value too long"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO orders").WithArgs(anyArgs(15)...).WillReturnError(errors.New("value too long"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO orders").WithArgs(anyArgs(15)...).WillReturnRows(savedRows(order.OrderUID))
+	expectHistory(mock)
+	mock.ExpectExec("INSERT INTO delivery").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO payment").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM items").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO items").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	errs := service.ProcessBatch(batch)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Error(t, errs[0])
+	assert.False(t, errors.Is(errs[0], ErrInvalidMessage))
+	assert.NoError(t, errs[1])
+	_, ok := cache.Get(poison.OrderUID)
+	assert.False(t, ok)
+	_, ok = cache.Get(order.OrderUID)
+	assert.True(t, ok)
+}
+
+func TestInsertRowsSplitsStatements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rows := make([][]interface{}, maxParams/2+1)
+	for i := range rows {
+		rows[i] = []interface{}{i, "x"}
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO t \(a, b\) VALUES \(\$1, \$2\), \(\$3, \$4\)`).
+		WithArgs(anyArgs(maxParams - 1)...).
+		WillReturnResult(sqlmock.NewResult(0, int64(len(rows)-1)))
+	mock.ExpectExec(`INSERT INTO t \(a, b\) VALUES \(\$1, \$2\) ON CONFLICT DO NOTHING`).
+		WithArgs(len(rows)-1, "x").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	assert.NoError(t, insertRows(context.Background(), tx, "INSERT INTO t (a, b) VALUES ", rows, " ON CONFLICT DO NOTHING"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
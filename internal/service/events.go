@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"order-service/internal/models"
+	"time"
+)
+
+// recordEvents adds an event per saved order to the outbox, in the same
+// transaction, so that the relay publishes it once the order is committed.
+func recordEvents(ctx context.Context, tx *sql.Tx, saved []*models.Order, inserted map[string]bool) error {
+	now := time.Now()
+	rows := make([][]interface{}, 0, len(saved))
+	for _, order := range saved {
+		event := models.OrderEvent{
+			Type:         models.EventOrderUpdated,
+			OrderUID:     order.OrderUID,
+			SourceStream: order.SourceStream,
+			SourceSeq:    order.SourceSeq,
+			OccurredAt:   now,
+			Order:        order,
+		}
+		if inserted[order.OrderUID] {
+			event.Type = models.EventOrderCreated
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{event.Type, order.OrderUID, payload})
+	}
+
+	return insertRows(ctx, tx, `INSERT INTO outbox (subject, order_uid, payload) VALUES `, rows, "")
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"order-service/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GetOrderHistory returns the stored messages of an order, oldest first.
+// Orders saved before the history was introduced have none.
+func (s *orderService) GetOrderHistory(orderUID string) ([]models.OrderVersion, error) {
+	rows, err := s.db.Query(`
+		SELECT id, order_uid, source_stream, source_seq, payload, diff, received_at, recorded_at
+		FROM order_history WHERE order_uid = $1 ORDER BY id`, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order history: %v", err)
+	}
+	defer rows.Close()
+
+	versions := []models.OrderVersion{}
+	for rows.Next() {
+		var v models.OrderVersion
+		var payload, diff []byte
+		err := rows.Scan(&v.ID, &v.OrderUID, &v.SourceStream, &v.SourceSeq, &payload, &diff,
+			&v.ReceivedAt, &v.RecordedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order history: %v", err)
+		}
+		v.Payload = payload
+		if diff != nil {
+			if err := json.Unmarshal(diff, &v.Diff); err != nil {
+				return nil, fmt.Errorf("failed to decode order history diff: %v", err)
+			}
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load order history: %v", err)
+	}
+
+	if len(versions) == 0 {
+		if _, err := s.GetOrder(orderUID); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+// recordHistory appends the messages to order_history, each with its diff
+// against the previous message of the same order.
+func recordHistory(ctx context.Context, tx *sql.Tx, batch []received) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var uids []string
+	previous := make(map[string][]byte)
+	for _, r := range batch {
+		if _, ok := previous[r.order.OrderUID]; !ok {
+			previous[r.order.OrderUID] = nil
+			uids = append(uids, r.order.OrderUID)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT ON (order_uid) order_uid, payload
+		FROM order_history WHERE order_uid = ANY($1)
+		ORDER BY order_uid, id DESC`, pq.Array(uids))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var uid string
+		var payload []byte
+		if err := rows.Scan(&uid, &payload); err != nil {
+			rows.Close()
+			return err
+		}
+		previous[uid] = payload
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	historyRows := make([][]interface{}, 0, len(batch))
+	for _, r := range batch {
+		uid := r.order.OrderUID
+
+		var diff interface{}
+		if prev := previous[uid]; prev != nil {
+			changes, err := diffPayloads(prev, r.msg.Data)
+			if err != nil {
+				return err
+			}
+			if diff, err = json.Marshal(changes); err != nil {
+				return err
+			}
+		}
+		previous[uid] = r.msg.Data
+
+		receivedAt := r.msg.ReceivedAt
+		if receivedAt.IsZero() {
+			receivedAt = time.Now()
+		}
+		historyRows = append(historyRows, []interface{}{
+			uid, r.msg.Stream, r.msg.Sequence, r.msg.Data, diff, receivedAt,
+		})
+	}
+
+	return insertRows(ctx, tx, `
+		INSERT INTO order_history (order_uid, source_stream, source_seq, payload, diff, received_at)
+		VALUES `, historyRows, "")
+}
+
+// diffPayloads compares two JSON documents leaf by leaf. Paths join object
+// keys and array indexes with dots, e.g. "items.0.price".
+func diffPayloads(prev, next []byte) (map[string]models.FieldChange, error) {
+	before, err := flattenJSON(prev)
+	if err != nil {
+		return nil, err
+	}
+	after, err := flattenJSON(next)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]models.FieldChange)
+	for path, old := range before {
+		if value, ok := after[path]; !ok || !bytes.Equal(old, value) {
+			changes[path] = models.FieldChange{Old: old, New: value}
+		}
+	}
+	for path, value := range after {
+		if _, ok := before[path]; !ok {
+			changes[path] = models.FieldChange{New: value}
+		}
+	}
+	return changes, nil
+}
+
+func flattenJSON(data []byte) (map[string]json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	leaves := make(map[string]json.RawMessage)
+	if err := flatten("", value, leaves); err != nil {
+		return nil, err
+	}
+	return leaves, nil
+}
+
+func flatten(path string, value interface{}, leaves map[string]json.RawMessage) error {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) > 0 {
+			for key, item := range v {
+				if err := flatten(join(key), item, leaves); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			for i, item := range v {
+				if err := flatten(join(strconv.Itoa(i)), item, leaves); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	leaves[path] = raw
+	return nil
+}
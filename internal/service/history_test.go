@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"order-service/internal/cache"
+	"order-service/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffPayloads(t *testing.T) {
+	prev := []byte(`{"track_number":"A","payment":{"amount":1000},"items":[{"price":1},{"price":2}],"locale":"en"}`)
+	next := []byte(`{"track_number":"B","payment":{"amount":1000},"items":[{"price":1}],"shardkey":"9","locale":"en"}`)
+
+	changes, err := diffPayloads(prev, next)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]models.FieldChange{
+		"track_number":  {Old: json.RawMessage(`"A"`), New: json.RawMessage(`"B"`)},
+		"items.1.price": {Old: json.RawMessage(`2`)},
+		"shardkey":      {New: json.RawMessage(`"9"`)},
+	}, changes)
+
+	changes, err = diffPayloads(prev, prev)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+// diffArg matches the diff column: NULL, or a JSON object with exactly the
+// given paths.
+type diffArg []string
+
+func (a diffArg) Match(v driver.Value) bool {
+	if a == nil {
+		return v == nil
+	}
+	data, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+	var changes map[string]models.FieldChange
+	if json.Unmarshal(data, &changes) != nil || len(changes) != len(a) {
+		return false
+	}
+	for _, path := range a {
+		if _, ok := changes[path]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRecordHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	first := testOrder()
+	other := testOrder()
+	other.OrderUID = "test-456"
+	batch := []received{
+		{order: &first, msg: Message{Data: []byte(`{"order_uid":"test-123","track_number":"B"}`), Stream: "stan/orders", Sequence: 5}},
+		{order: &other, msg: Message{Data: []byte(`{"order_uid":"test-456"}`), Stream: "stan/orders", Sequence: 6}},
+		{order: &first, msg: Message{Data: []byte(`{"order_uid":"test-123","track_number":"C","locale":"en"}`), Stream: "stan/orders", Sequence: 7}},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT DISTINCT ON").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "payload"}).
+			AddRow("test-123", []byte(`{"order_uid":"test-123","track_number":"A"}`)))
+	mock.ExpectExec("INSERT INTO order_history").
+		WithArgs(
+			"test-123", "stan/orders", uint64(5), batch[0].msg.Data, diffArg{"track_number"}, sqlmock.AnyArg(),
+			"test-456", "stan/orders", uint64(6), batch[1].msg.Data, diffArg(nil), sqlmock.AnyArg(),
+			"test-123", "stan/orders", uint64(7), batch[2].msg.Data, diffArg{"track_number", "locale"}, sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(3, 3))
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	assert.NoError(t, recordHistory(context.Background(), tx, batch))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetOrderHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := New(db, cache.New())
+	receivedAt := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM order_history WHERE order_uid = \\$1 ORDER BY id").
+		WithArgs("test-123").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "order_uid", "source_stream", "source_seq", "payload", "diff", "received_at", "recorded_at",
+		}).
+			AddRow(1, "test-123", "stan/orders", uint64(5), []byte(`{"track_number":"A"}`), nil, receivedAt, receivedAt).
+			AddRow(2, "test-123", "stan/orders", uint64(7), []byte(`{"track_number":"B"}`),
+				[]byte(`{"track_number":{"old":"A","new":"B"}}`), receivedAt, receivedAt))
+
+	versions, err := service.GetOrderHistory("test-123")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Len(t, versions, 2)
+	assert.Nil(t, versions[0].Diff)
+	assert.JSONEq(t, `{"track_number":"A"}`, string(versions[0].Payload))
+	assert.Equal(t, json.RawMessage(`"B"`), versions[1].Diff["track_number"].New)
+	assert.Equal(t, uint64(7), versions[1].SourceSeq)
+}
+
+func TestGetOrderHistory_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := New(db, cache.New())
+
+	mock.ExpectQuery("FROM order_history").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "order_uid", "source_stream", "source_seq", "payload", "diff", "received_at", "recorded_at",
+		}))
+	mock.ExpectQuery("FROM orders o").WithArgs("missing").WillReturnRows(sqlmock.NewRows(orderColumns))
+
+	_, err = service.GetOrderHistory("missing")
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"order-service/internal/models"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// OrderFilter selects orders for ListOrders. Empty fields are not applied.
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	CreatedFrom     time.Time
+	CreatedTo       time.Time
+	Provider        string
+	Currency        string
+	Brand           string
+	NmID            int
+	Cursor          string
+	Limit           int
+}
+
+type OrderPage struct {
+	Orders     []*models.Order `json:"orders"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// ListOrders returns orders newest first. Pages are keyed by
+// (date_created, order_uid) of the last order, so inserts between requests
+// do not shift or duplicate results.
+func (s *orderService) ListOrders(filter OrderFilter) (*OrderPage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.CustomerID != "" {
+		add("o.customer_id = $%d", filter.CustomerID)
+	}
+	if filter.TrackNumber != "" {
+		add("o.track_number = $%d", filter.TrackNumber)
+	}
+	if filter.DeliveryService != "" {
+		add("o.delivery_service = $%d", filter.DeliveryService)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		add("o.date_created >= $%d", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		add("o.date_created < $%d", filter.CreatedTo)
+	}
+	if filter.Provider != "" {
+		add("p.provider = $%d", filter.Provider)
+	}
+	if filter.Currency != "" {
+		add("p.currency = $%d", filter.Currency)
+	}
+	if filter.Brand != "" {
+		add("EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.brand = $%d)", filter.Brand)
+	}
+	if filter.NmID != 0 {
+		add("EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.nm_id = $%d)", filter.NmID)
+	}
+	if filter.Cursor != "" {
+		created, uid, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, created, uid)
+		conds = append(conds, fmt.Sprintf("(o.date_created, o.order_uid) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := selectOrders
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY o.date_created DESC, o.order_uid DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %v", err)
+	}
+	defer rows.Close()
+
+	page := &OrderPage{Orders: make([]*models.Order, 0, limit)}
+	hasMore := false
+	for rows.Next() {
+		if len(page.Orders) == limit {
+			hasMore = true
+			break
+		}
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Orders = append(page.Orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := s.attachItems(page.Orders); err != nil {
+		return nil, err
+	}
+
+	if hasMore {
+		last := page.Orders[len(page.Orders)-1]
+		page.NextCursor = encodeCursor(last.DateCreated, last.OrderUID)
+	}
+	return page, nil
+}
+
+func (s *orderService) attachItems(orders []*models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	uids := make([]string, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+	}
+
+	items, err := s.loadItemsBatch(uids)
+	if err != nil {
+		return fmt.Errorf("failed to load items: %v", err)
+	}
+	for _, order := range orders {
+		order.Items = items[order.OrderUID]
+	}
+	return nil
+}
+
+func encodeCursor(created time.Time, orderUID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(created.Format(time.RFC3339Nano) + "|" + orderUID))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	created, uid, ok := strings.Cut(string(raw), "|")
+	if !ok || uid == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, created)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return t, uid, nil
+}
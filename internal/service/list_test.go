@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"order-service/internal/cache"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListOrders_FiltersAndCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := New(db, cache.New())
+
+	newer, older := testOrder(), testOrder()
+	newer.OrderUID, older.OrderUID = "order-2", "order-1"
+	older.DateCreated = newer.DateCreated.Add(-time.Hour)
+
+	mock.ExpectQuery(`WHERE o.customer_id = \$1 AND p.currency = \$2 AND EXISTS \(SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.brand = \$3\) ORDER BY o.date_created DESC, o.order_uid DESC LIMIT \$4`).
+		WithArgs("test", "USD", "Vivienne Sabo", 2).
+		WillReturnRows(sqlmock.NewRows(orderColumns).
+			AddRow(orderRow(newer)...).
+			AddRow(orderRow(older)...))
+	mock.ExpectQuery("FROM items WHERE order_uid = ANY").
+		WithArgs(`{"order-2"}`).
+		WillReturnRows(sqlmock.NewRows(append([]string{"order_uid"}, itemColumns...)))
+
+	page, err := service.ListOrders(OrderFilter{
+		CustomerID: "test",
+		Currency:   "USD",
+		Brand:      "Vivienne Sabo",
+		Limit:      1,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Len(t, page.Orders, 1)
+	assert.Equal(t, "order-2", page.Orders[0].OrderUID)
+	assert.NotEmpty(t, page.NextCursor)
+
+	created, uid, err := decodeCursor(page.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, "order-2", uid)
+	assert.True(t, newer.DateCreated.Equal(created))
+
+	mock.ExpectQuery(`WHERE \(o.date_created, o.order_uid\) < \(\$1, \$2\) ORDER BY (.+) LIMIT \$3`).
+		WithArgs(sqlmock.AnyArg(), "order-2", DefaultPageSize+1).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(orderRow(older)...))
+	mock.ExpectQuery("FROM items WHERE order_uid = ANY").
+		WithArgs(`{"order-1"}`).
+		WillReturnRows(sqlmock.NewRows(append([]string{"order_uid"}, itemColumns...)))
+
+	page, err = service.ListOrders(OrderFilter{Cursor: page.NextCursor})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Len(t, page.Orders, 1)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestListOrders_InvalidCursor(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := New(db, cache.New())
+
+	for _, cursor := range []string{"!!!", encodeCursor(time.Now(), "")[:4], "bm90LWEtY3Vyc29y"} {
+		_, err = service.ListOrders(OrderFilter{Cursor: cursor})
+		assert.True(t, errors.Is(err, ErrInvalidCursor), cursor)
+	}
+}
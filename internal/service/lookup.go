@@ -0,0 +1,130 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"order-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// FindByTrackNumber resolves an order or item track number to at most
+// MaxPageSize orders, newest first. The matching orders are always looked up
+// in the database, since the cache may hold only some of them; cached
+// orders are served from the cache and the rest loaded in one query.
+func (s *orderService) FindByTrackNumber(trackNumber string) ([]*models.Order, error) {
+	rows, err := s.db.Query(`
+		SELECT o.order_uid FROM orders o
+		WHERE o.order_uid IN (
+			SELECT order_uid FROM orders WHERE track_number = $1
+			UNION
+			SELECT order_uid FROM items WHERE track_number = $1)
+		ORDER BY o.date_created DESC, o.order_uid LIMIT $2`, trackNumber, MaxPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up track number: %v", err)
+	}
+	defer rows.Close()
+
+	var uids []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		uids = append(uids, uid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(uids) == 0 {
+		return nil, ErrOrderNotFound
+	}
+
+	byUID := make(map[string]*models.Order, len(uids))
+	var missing []string
+	for _, uid := range uids {
+		if order, exists := s.cache.Get(uid); exists {
+			byUID[uid] = order
+		} else {
+			missing = append(missing, uid)
+		}
+	}
+	if err := s.loadOrders(missing, byUID); err != nil {
+		return nil, err
+	}
+
+	orders := make([]*models.Order, 0, len(uids))
+	for _, uid := range uids {
+		if order, exists := byUID[uid]; exists {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// loadOrders reads the orders with their items into byUID and caches them.
+func (s *orderService) loadOrders(uids []string, byUID map[string]*models.Order) error {
+	if len(uids) == 0 {
+		return nil
+	}
+
+	generation := s.cache.StartLoad()
+	defer s.cache.EndLoad(generation)
+
+	rows, err := s.db.Query(selectOrders+" WHERE o.order_uid = ANY($1)", pq.Array(uids))
+	if err != nil {
+		return fmt.Errorf("failed to load orders: %v", err)
+	}
+	defer rows.Close()
+
+	var orders []*models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return fmt.Errorf("failed to load orders: %v", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load orders: %v", err)
+	}
+	rows.Close()
+
+	if err := s.attachItems(orders); err != nil {
+		return err
+	}
+	for _, order := range orders {
+		byUID[order.OrderUID] = order
+		s.cache.SetLoaded(order.OrderUID, order, generation)
+	}
+	return nil
+}
+
+func (s *orderService) FindByTransaction(transaction string) (*models.Order, error) {
+	if order, exists := s.cache.GetByTransaction(transaction); exists {
+		return order, nil
+	}
+	return s.findBy("SELECT order_uid FROM payment WHERE transaction = $1", transaction)
+}
+
+func (s *orderService) FindByRid(rid string) (*models.Order, error) {
+	if order, exists := s.cache.GetByRid(rid); exists {
+		return order, nil
+	}
+	return s.findBy("SELECT order_uid FROM items WHERE rid = $1 LIMIT 1", rid)
+}
+
+func (s *orderService) findBy(query, value string) (*models.Order, error) {
+	var uid string
+	err := s.db.QueryRow(query, value).Scan(&uid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up order: %v", err)
+	}
+	return s.GetOrder(uid)
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"order-service/internal/cache"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindByTransaction_Cached(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	order := testOrder()
+	cache.Set(order.OrderUID, &order)
+
+	found, err := service.FindByTransaction(order.Payment.Transaction)
+	assert.NoError(t, err)
+	assert.Equal(t, order.OrderUID, found.OrderUID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindByRid_Database(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	order := testOrder()
+	mock.ExpectQuery("SELECT order_uid FROM items WHERE rid").
+		WithArgs("test-rid").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow(order.OrderUID))
+	mock.ExpectQuery("SELECT (.+) FROM orders o").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(orderRow(order)...))
+	mock.ExpectQuery("SELECT (.+) FROM items").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows(itemColumns).AddRow(itemRow(order.Items[0])...))
+
+	found, err := service.FindByRid("test-rid")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, order.OrderUID, found.OrderUID)
+
+	cached, exists := cache.GetByRid("test-rid")
+	assert.True(t, exists)
+	assert.Same(t, found, cached)
+}
+
+func TestFindByTrackNumber(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	cachedOrder, storedOrder := testOrder(), testOrder()
+	storedOrder.OrderUID = "stored-123"
+	storedOrder.DateCreated = cachedOrder.DateCreated.Add(time.Hour)
+	cache.Set(cachedOrder.OrderUID, &cachedOrder)
+
+	// The stored order is not cached, yet it is found next to the cached one.
+	mock.ExpectQuery("SELECT order_uid FROM orders WHERE track_number = (.+) UNION (.+) LIMIT \\$2").
+		WithArgs("TRACK123", MaxPageSize).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).
+			AddRow(storedOrder.OrderUID).
+			AddRow(cachedOrder.OrderUID))
+	mock.ExpectQuery("SELECT (.+) FROM orders o (.+) ANY").
+		WithArgs(`{"stored-123"}`).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(orderRow(storedOrder)...))
+	mock.ExpectQuery("FROM items WHERE order_uid = ANY").
+		WithArgs(`{"stored-123"}`).
+		WillReturnRows(sqlmock.NewRows(append([]string{"order_uid"}, itemColumns...)))
+
+	found, err := service.FindByTrackNumber("TRACK123")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Len(t, found, 2)
+	assert.Equal(t, storedOrder.OrderUID, found[0].OrderUID)
+	assert.Same(t, &cachedOrder, found[1])
+	_, exists := cache.Get(storedOrder.OrderUID)
+	assert.True(t, exists)
+
+	mock.ExpectQuery("SELECT order_uid FROM orders WHERE track_number").
+		WithArgs("UNKNOWN", MaxPageSize).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}))
+
+	_, err = service.FindByTrackNumber("UNKNOWN")
+	assert.True(t, errors.Is(err, ErrOrderNotFound))
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"order-service/internal/cache"
+	"order-service/internal/metrics"
+	"order-service/internal/models"
+	"os"
+	"time"
+)
+
+const defaultRestoreBatchSize = 500
+
+// RestoreOptions define the restore window. Zero values mean no limit.
+type RestoreOptions struct {
+	// MaxAge skips orders created earlier than MaxAge ago.
+	MaxAge time.Duration
+	// Limit keeps only the newest Limit orders.
+	Limit int
+	// BatchSize is the number of orders whose items are fetched per query.
+	BatchSize int
+	// SnapshotPath, if set, is where SaveSnapshot writes the cache and
+	// where RestoreCache looks for it first.
+	SnapshotPath string
+}
+
+// snapshotMargin widens the reconciliation window after a snapshot to cover
+// transactions that were in flight while it was taken and clock skew
+// between the service and Postgres.
+const snapshotMargin = time.Minute
+
+// RestoreCache loads the cache snapshot if there is a valid one and then
+// only the orders written since it was taken. Otherwise it streams orders
+// from the database oldest first, so that a bounded cache ends up holding
+// the newest ones. Items are fetched for a whole batch of orders per query.
+// Cancelling ctx aborts the restore between batches.
+func (s *orderService) RestoreCache(ctx context.Context) error {
+	started := time.Now()
+	// Orders changed while the restore runs are not cached with the
+	// version read before the change.
+	generation := s.cache.StartLoad()
+	defer s.cache.EndLoad(generation)
+
+	query, args := s.restoreQuery(started)
+	if snap := s.loadSnapshot(); snap != nil {
+		refused := s.cacheLoaded(snap.Orders, generation)
+		log.Printf("Cache snapshot of %s loaded with %d orders (%d changed meanwhile), last sequences %v",
+			snap.CreatedAt.Format(time.RFC3339), len(snap.Orders)-refused, refused, snap.LastSequence)
+
+		query = selectOrders + " WHERE o.updated_at >= $1 ORDER BY o.date_created"
+		args = []interface{}{snap.CreatedAt.Add(-snapshotMargin)}
+	}
+
+	restored, err := s.restoreRows(ctx, query, args, generation, started)
+	if err != nil {
+		return err
+	}
+
+	elapsed := time.Since(started)
+	metrics.RestoreDuration.Set(elapsed.Seconds())
+	metrics.RestoredOrders.Set(float64(restored))
+	log.Printf("Cache restored with %d orders (%d loaded) in %s",
+		s.cache.Size(), restored, elapsed.Round(time.Millisecond))
+	return nil
+}
+
+// loadSnapshot returns nil when snapshots are disabled or the snapshot is
+// missing or unusable; the full restore is the fallback.
+func (s *orderService) loadSnapshot() *cache.Snapshot {
+	if s.restore.SnapshotPath == "" {
+		return nil
+	}
+	snap, err := cache.LoadSnapshot(s.restore.SnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No cache snapshot at %s, restoring from the database", s.restore.SnapshotPath)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Ignoring cache snapshot %s: %v", s.restore.SnapshotPath, err)
+		return nil
+	}
+	return snap
+}
+
+// SaveSnapshot writes the cache to RestoreOptions.SnapshotPath, if set.
+func (s *orderService) SaveSnapshot() error {
+	if s.restore.SnapshotPath == "" {
+		return nil
+	}
+
+	started := time.Now()
+	snap := s.cache.Snapshot()
+	if err := snap.Save(s.restore.SnapshotPath); err != nil {
+		return fmt.Errorf("failed to save cache snapshot: %v", err)
+	}
+	log.Printf("Cache snapshot saved with %d orders in %s", len(snap.Orders), time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+func (s *orderService) restoreRows(ctx context.Context, query string, args []interface{}, generation uint64, started time.Time) (int, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	batchSize := s.restore.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRestoreBatchSize
+	}
+
+	batch := make([]*models.Order, 0, batchSize)
+	restored, refused := 0, 0
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return 0, err
+		}
+
+		batch = append(batch, order)
+		if len(batch) < batchSize {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		n, err := s.restoreBatch(batch, generation)
+		if err != nil {
+			return 0, err
+		}
+		restored += len(batch)
+		refused += n
+		batch = batch[:0]
+		log.Printf("Cache restore: %d orders loaded in %s, %d not cached as changed meanwhile",
+			restored, time.Since(started).Round(time.Millisecond), refused)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := s.restoreBatch(batch, generation)
+	if err != nil {
+		return 0, err
+	}
+	if refused += n; refused > 0 {
+		log.Printf("Cache restore: %d orders not cached as changed meanwhile", refused)
+	}
+	return restored + len(batch), nil
+}
+
+func (s *orderService) restoreQuery(now time.Time) (string, []interface{}) {
+	var args []interface{}
+	filter := ""
+	if s.restore.MaxAge > 0 {
+		args = append(args, now.Add(-s.restore.MaxAge))
+		filter = fmt.Sprintf(" WHERE o.date_created >= $%d", len(args))
+	}
+
+	if s.restore.Limit > 0 {
+		args = append(args, s.restore.Limit)
+		filter = fmt.Sprintf(`
+	WHERE o.order_uid IN (
+		SELECT o.order_uid FROM orders o%s ORDER BY o.date_created DESC LIMIT $%d
+	)`, filter, len(args))
+	}
+
+	return selectOrders + filter + " ORDER BY o.date_created", args
+}
+
+// restoreBatch returns how many orders of the batch were not cached.
+func (s *orderService) restoreBatch(batch []*models.Order, generation uint64) (int, error) {
+	if err := s.attachItems(batch); err != nil {
+		return 0, err
+	}
+	return s.cacheLoaded(batch, generation), nil
+}
+
+func (s *orderService) cacheLoaded(orders []*models.Order, generation uint64) int {
+	refused := 0
+	for _, order := range orders {
+		if !s.cache.SetLoaded(order.OrderUID, order, generation) {
+			refused++
+		}
+	}
+	return refused
+}
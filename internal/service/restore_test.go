@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"order-service/internal/cache"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreCache_Batches(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache, WithRestoreOptions(RestoreOptions{BatchSize: 2}))
+
+	first, second, third := testOrder(), testOrder(), testOrder()
+	first.OrderUID, second.OrderUID, third.OrderUID = "order-1", "order-2", "order-3"
+
+	mock.ExpectQuery("SELECT (.+) FROM orders o (.+) ORDER BY o.date_created").
+		WillReturnRows(sqlmock.NewRows(orderColumns).
+			AddRow(orderRow(first)...).
+			AddRow(orderRow(second)...).
+			AddRow(orderRow(third)...))
+	mock.ExpectQuery("FROM items WHERE order_uid = ANY").
+		WithArgs(`{"order-1","order-2"}`).
+		WillReturnRows(sqlmock.NewRows(append([]string{"order_uid"}, itemColumns...)).
+			AddRow(append([]driver.Value{"order-1"}, itemRow(first.Items[0])...)...).
+			AddRow(append([]driver.Value{"order-2"}, itemRow(second.Items[0])...)...).
+			AddRow(append([]driver.Value{"order-2"}, itemRow(second.Items[0])...)...))
+	mock.ExpectQuery("FROM items WHERE order_uid = ANY").
+		WithArgs(`{"order-3"}`).
+		WillReturnRows(sqlmock.NewRows(append([]string{"order_uid"}, itemColumns...)))
+
+	err = service.RestoreCache(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, 3, cache.Size())
+	restored, _ := cache.Get("order-1")
+	assert.Len(t, restored.Items, 1)
+	restored, _ = cache.Get("order-2")
+	assert.Len(t, restored.Items, 2)
+	restored, _ = cache.Get("order-3")
+	assert.Empty(t, restored.Items)
+}
+
+func TestRestoreCache_Cancelled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	mock.ExpectQuery("SELECT (.+) FROM orders o").
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(orderRow(testOrder())...))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, service.RestoreCache(ctx))
+	assert.Equal(t, 0, cache.Size())
+}
+
+func TestRestoreQuery_Window(t *testing.T) {
+	now := time.Now()
+
+	s := &orderService{}
+	query, args := s.restoreQuery(now)
+	assert.NotContains(t, query, "WHERE")
+	assert.Empty(t, args)
+
+	s.restore = RestoreOptions{MaxAge: 24 * time.Hour}
+	query, args = s.restoreQuery(now)
+	assert.Contains(t, query, "WHERE o.date_created >= $1")
+	assert.Equal(t, []interface{}{now.Add(-24 * time.Hour)}, args)
+
+	s.restore = RestoreOptions{MaxAge: 24 * time.Hour, Limit: 1000}
+	query, args = s.restoreQuery(now)
+	assert.Contains(t, query, "WHERE o.date_created >= $1 ORDER BY o.date_created DESC LIMIT $2")
+	assert.Equal(t, []interface{}{now.Add(-24 * time.Hour), 1000}, args)
+}
+
+func TestRestoreCache_FromSnapshot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	kept, changed := testOrder(), testOrder()
+	kept.OrderUID, changed.OrderUID = "order-1", "order-2"
+	kept.SourceStream, kept.SourceSeq = "stan/orders", 5
+
+	previous := New(db, cache.New(), WithRestoreOptions(RestoreOptions{SnapshotPath: path}))
+	previous.(*orderService).cache.Set(kept.OrderUID, &kept)
+	previous.(*orderService).cache.Set(changed.OrderUID, &changed)
+	assert.NoError(t, previous.SaveSnapshot())
+	snap, err := cache.LoadSnapshot(path)
+	assert.NoError(t, err)
+
+	updated := changed
+	updated.TrackNumber = "TRACK456"
+
+	cache := cache.New()
+	service := New(db, cache, WithRestoreOptions(RestoreOptions{SnapshotPath: path}))
+
+	mock.ExpectQuery("SELECT (.+) FROM orders o (.+) WHERE o.updated_at >= \\$1 ORDER BY o.date_created").
+		WithArgs(snap.CreatedAt.Add(-snapshotMargin)).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(orderRow(updated)...))
+	mock.ExpectQuery("FROM items WHERE order_uid = ANY").
+		WillReturnRows(sqlmock.NewRows(append([]string{"order_uid"}, itemColumns...)))
+
+	assert.NoError(t, service.RestoreCache(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, 2, cache.Size())
+	restored, _ := cache.Get("order-1")
+	assert.Equal(t, uint64(5), restored.SourceSeq)
+	assert.Len(t, restored.Items, 1)
+	restored, _ = cache.Get("order-2")
+	assert.Equal(t, "TRACK456", restored.TrackNumber)
+}
+
+func TestRestoreCache_MissingSnapshot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	service := New(db, cache.New(), WithRestoreOptions(RestoreOptions{SnapshotPath: path}))
+
+	mock.ExpectQuery("SELECT (.+) FROM orders o LEFT JOIN delivery d (.+) LEFT JOIN payment p (.+) ORDER BY o.date_created").
+		WillReturnRows(sqlmock.NewRows(orderColumns))
+
+	assert.NoError(t, service.RestoreCache(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
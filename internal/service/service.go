@@ -2,64 +2,225 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"order-service/internal/cache"
+	"order-service/internal/consistency"
+	"order-service/internal/metrics"
 	"order-service/internal/models"
+	"strings"
+	"time"
 
-	"github.com/nats-io/stan.go"
+	"github.com/lib/pq"
 )
 
+// ErrInvalidMessage marks payloads that will never be processed successfully,
+// so redelivering them is pointless.
+var ErrInvalidMessage = errors.New("invalid message")
+
+var ErrOrderNotFound = errors.New("order not found")
+
 type OrderService interface {
-	ProcessMessage(data []byte) error
+	ProcessMessage(msg Message) error
+	ProcessBatch(batch []Message) []error
+	ProcessStatusEvent(msg Message) error
 	GetOrder(orderUID string) (*models.Order, error)
+	GetOrderHistory(orderUID string) ([]models.OrderVersion, error)
+	GetOrderStatus(orderUID string) (*models.StatusTimeline, error)
+	ListOrders(filter OrderFilter) (*OrderPage, error)
+	FindByTrackNumber(trackNumber string) ([]*models.Order, error)
+	FindByTransaction(transaction string) (*models.Order, error)
+	FindByRid(rid string) (*models.Order, error)
 	GetCacheSize() int
-	RestoreCache() error
+	GetCacheStats() cache.Stats
+	RestoreCache(ctx context.Context) error
+	SaveSnapshot() error
+	DeadLetter(letter *models.DeadLetter) error
+}
+
+// Message is a payload with its position in the stream it was read from.
+// Only sequences of the same stream can be ordered; sequence 0 means the
+// position is unknown and the message is never considered stale.
+type Message struct {
+	Data       []byte
+	Stream     string
+	Sequence   uint64
+	ReceivedAt time.Time
+}
+
+// received is a valid order together with the message it was decoded from.
+type received struct {
+	order *models.Order
+	msg   Message
+}
+
+// Publisher sends dead letters back to the broker.
+type Publisher interface {
+	Publish(subject string, data []byte) error
 }
 
 type orderService struct {
-	db       *sql.DB
-	cache    *cache.Cache
-	stanConn stan.Conn
+	db                *sql.DB
+	cache             *cache.Cache
+	publisher         Publisher
+	deadLetterChannel string
+	rules             *consistency.Engine
+	restore           RestoreOptions
 }
 
-func New(db *sql.DB, cache *cache.Cache, stanConn stan.Conn) OrderService {
-	return &orderService{
-		db:       db,
-		cache:    cache,
-		stanConn: stanConn,
+type Option func(*orderService)
+
+// WithDeadLetterPublisher makes DeadLetter republish rejected messages to
+// the given subject in addition to storing them.
+func WithDeadLetterPublisher(publisher Publisher, subject string) Option {
+	return func(s *orderService) {
+		s.publisher = publisher
+		s.deadLetterChannel = subject
 	}
 }
 
-func (s *orderService) ProcessMessage(data []byte) error {
-	if s.stanConn == nil {
-		return fmt.Errorf("NATS connection not initialized")
+// WithConsistencyRules runs the engine on every valid order before it is saved.
+func WithConsistencyRules(engine *consistency.Engine) Option {
+	return func(s *orderService) {
+		s.rules = engine
 	}
-	
-	var order models.Order
-	if err := json.Unmarshal(data, &order); err != nil {
-		return fmt.Errorf("invalid JSON: %v", err)
+}
+
+// WithRestoreOptions limits which orders RestoreCache loads and how.
+func WithRestoreOptions(opts RestoreOptions) Option {
+	return func(s *orderService) {
+		s.restore = opts
+	}
+}
+
+func New(db *sql.DB, cache *cache.Cache, opts ...Option) OrderService {
+	s := &orderService{
+		db:    db,
+		cache: cache,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
 
-	if order.OrderUID == "" {
-		return fmt.Errorf("order_uid is required")
+func (s *orderService) ProcessMessage(msg Message) error {
+	metrics.MessagesReceived.Inc()
+
+	order, err := s.prepare(msg)
+	if err != nil {
+		return err
+	}
+	if reason := s.superseded(order); reason != "" {
+		skipped(order, reason)
+		return nil
 	}
 
-	if err := s.saveOrder(&order); err != nil {
-		return fmt.Errorf("failed to save order: %v", err)
+	started := time.Now()
+	saved, err := s.saveOrders([]received{{order: order, msg: msg}})
+	metrics.SaveOrderDuration.Observe(time.Since(started).Seconds())
+	if err != nil {
+		return failed(metrics.ReasonDatabase, fmt.Errorf("failed to save order: %v", err))
+	}
+	if len(saved) == 0 {
+		skipped(order, metrics.SkipStale)
+		return nil
 	}
 
-	s.cache.Set(order.OrderUID, &order)
+	s.cache.Set(order.OrderUID, order)
+	metrics.MessagesProcessed.Inc()
 	log.Printf("Order %s processed successfully", order.OrderUID)
 	return nil
 }
 
+// prepare decodes and checks a message; every error it returns wraps
+// ErrInvalidMessage.
+func (s *orderService) prepare(msg Message) (*models.Order, error) {
+	var order models.Order
+	if err := json.Unmarshal(msg.Data, &order); err != nil {
+		return nil, failed(metrics.ReasonInvalidJSON, fmt.Errorf("%w: invalid JSON: %v", ErrInvalidMessage, err))
+	}
+
+	if err := order.Validate(); err != nil {
+		return nil, failed(metrics.ReasonValidation, fmt.Errorf("%w: %v", ErrInvalidMessage, err))
+	}
+
+	order.Violations = nil
+	if s.rules != nil {
+		result := s.rules.Evaluate(&order)
+		if v := result.Rejected(); v != nil {
+			return nil, failed(metrics.ReasonConsistency, fmt.Errorf("%w: rule %s: %s", ErrInvalidMessage, v.Rule, v.Message))
+		}
+		for _, v := range result.Violations {
+			log.Printf("Order %s violates rule %s (%s): %s", order.OrderUID, v.Rule, v.Action, v.Message)
+		}
+		order.Violations = result.Flagged()
+	}
+
+	hash := sha256.Sum256(msg.Data)
+	order.SourceStream = msg.Stream
+	order.SourceSeq = msg.Sequence
+	order.PayloadHash = hex.EncodeToString(hash[:])
+	return &order, nil
+}
+
+// superseded compares order with the cached version, so that redeliveries
+// of known messages are skipped without a database round trip. Orders that
+// are not cached are checked by the upsert itself.
+func (s *orderService) superseded(order *models.Order) string {
+	cached, ok := s.cache.Get(order.OrderUID)
+	if !ok {
+		return ""
+	}
+	if cached.PayloadHash == order.PayloadHash {
+		return metrics.SkipDuplicate
+	}
+	if !newer(order, cached) {
+		return metrics.SkipStale
+	}
+	return ""
+}
+
+func newer(order, than *models.Order) bool {
+	return order.SourceSeq == 0 || order.SourceStream != than.SourceStream || order.SourceSeq > than.SourceSeq
+}
+
+func skipped(order *models.Order, reason string) {
+	metrics.MessagesSkipped.WithLabelValues(reason).Inc()
+	log.Printf("Order %s seq=%d skipped: %s", order.OrderUID, order.SourceSeq, reason)
+}
+
+func failed(reason string, err error) error {
+	metrics.MessagesFailed.WithLabelValues(reason).Inc()
+	return err
+}
+
+// GetOrder serves orders from the cache and falls back to the database for
+// orders ingested by other instances or evicted from the cache.
 func (s *orderService) GetOrder(orderUID string) (*models.Order, error) {
-	order, exists := s.cache.Get(orderUID)
-	if !exists {
-		return nil, fmt.Errorf("order not found")
+	if order, exists := s.cache.Get(orderUID); exists {
+		return order, nil
+	}
+
+	generation := s.cache.StartLoad()
+	defer s.cache.EndLoad(generation)
+	order, err := s.loadOrder(orderUID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A message processed meanwhile may have cached a newer version; an
+	// order changed meanwhile is served as read but not cached.
+	if !s.cache.SetLoaded(order.OrderUID, order, generation) {
+		if cached, exists := s.cache.Get(orderUID); exists {
+			return cached, nil
+		}
+		log.Printf("Order %s changed while being loaded, not cached", orderUID)
 	}
 	return order, nil
 }
@@ -68,18 +229,88 @@ func (s *orderService) GetCacheSize() int {
 	return s.cache.Size()
 }
 
-func (s *orderService) saveOrder(order *models.Order) error {
+func (s *orderService) GetCacheStats() cache.Stats {
+	return s.cache.Stats()
+}
+
+// DeadLetter stores the letter and publishes it. A letter stored before a
+// failed publish is not stored twice when the message comes back; the
+// payload is part of the key, since sources may share channel names.
+func (s *orderService) DeadLetter(letter *models.DeadLetter) error {
+	_, err := s.db.Exec(`
+		INSERT INTO dead_letters (channel, sequence, reason, payload, received_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (channel, sequence, md5(payload)) DO NOTHING`,
+		letter.Channel, letter.Sequence, letter.Reason, letter.Payload, letter.ReceivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store dead letter: %v", err)
+	}
+
+	if s.deadLetterChannel != "" && s.publisher != nil {
+		data, err := json.Marshal(letter)
+		if err != nil {
+			return err
+		}
+		if err := s.publisher.Publish(s.deadLetterChannel, data); err != nil {
+			return fmt.Errorf("failed to publish dead letter: %v", err)
+		}
+	}
+
+	log.Printf("Message seq=%d from %s moved to dead letters: %s", letter.Sequence, letter.Channel, letter.Reason)
+	return nil
+}
+
+// saveOrders upserts the orders with their delivery, payment and items and
+// records their history in one transaction, using a single multi-row
+// statement per table. When the batch holds several messages of one order
+// the last one is stored and all of them go to the history. An order is
+// left untouched when the stored version has the same payload or a newer
+// sequence of the same stream; saveOrders returns the orders it actually
+// wrote. A payment transaction shared by several orders goes to the last
+// of them, as with separate upserts.
+func (s *orderService) saveOrders(batch []received) ([]*models.Order, error) {
+	last := make(map[string]int, len(batch))
+	for i, r := range batch {
+		last[r.order.OrderUID] = i
+	}
+	var orders []*models.Order
+	for i, r := range batch {
+		if last[r.order.OrderUID] == i {
+			orders = append(orders, r.order)
+		}
+	}
+
+	orderRows := make([][]interface{}, 0, len(orders))
+	for _, order := range orders {
+		violations, err := json.Marshal(order.Violations)
+		if err != nil {
+			return nil, err
+		}
+		if order.Violations == nil {
+			violations = []byte("[]")
+		}
+
+		orderRows = append(orderRows, []interface{}{
+			order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+			order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+			violations, order.SourceStream, order.SourceSeq, order.PayloadHash,
+		})
+	}
+
 	ctx := context.Background()
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, 
-			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	written := make(map[string]bool)
+	inserted := make(map[string]bool)
+	for _, stmt := range buildInserts(`
+		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature,
+			customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, violations,
+			source_stream, source_seq, payload_hash)
+		VALUES `, orderRows, `
 		ON CONFLICT (order_uid) DO UPDATE SET
 			track_number = EXCLUDED.track_number,
 			entry = EXCLUDED.entry,
@@ -90,16 +321,72 @@ func (s *orderService) saveOrder(order *models.Order) error {
 			shardkey = EXCLUDED.shardkey,
 			sm_id = EXCLUDED.sm_id,
 			date_created = EXCLUDED.date_created,
-			oof_shard = EXCLUDED.oof_shard`,
-		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
-		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard)
-	if err != nil {
-		return err
+			oof_shard = EXCLUDED.oof_shard,
+			violations = EXCLUDED.violations,
+			source_stream = EXCLUDED.source_stream,
+			source_seq = EXCLUDED.source_seq,
+			payload_hash = EXCLUDED.payload_hash,
+			updated_at = NOW()
+		WHERE orders.payload_hash <> EXCLUDED.payload_hash
+			AND (EXCLUDED.source_seq = 0
+				OR orders.source_stream <> EXCLUDED.source_stream
+				OR orders.source_seq < EXCLUDED.source_seq)
+		RETURNING order_uid, xmax = 0`) {
+		if err := queryUIDs(ctx, tx, stmt, written, inserted); err != nil {
+			return nil, err
+		}
 	}
 
-	_, err = tx.ExecContext(ctx, `
+	var saved []*models.Order
+	var deliveryRows, paymentRows, itemRows [][]interface{}
+	var uids []string
+	payments := make(map[string]int)
+	for _, order := range orders {
+		if !written[order.OrderUID] {
+			continue
+		}
+		saved = append(saved, order)
+		uids = append(uids, order.OrderUID)
+
+		deliveryRows = append(deliveryRows, []interface{}{
+			order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
+			order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email,
+		})
+		payment := []interface{}{
+			order.Payment.Transaction, order.OrderUID, order.Payment.RequestID, order.Payment.Currency,
+			order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank,
+			order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee,
+		}
+		if i, ok := payments[order.Payment.Transaction]; ok {
+			paymentRows[i] = payment
+		} else {
+			payments[order.Payment.Transaction] = len(paymentRows)
+			paymentRows = append(paymentRows, payment)
+		}
+		for _, item := range order.Items {
+			itemRows = append(itemRows, []interface{}{
+				order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name,
+				item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status,
+			})
+		}
+	}
+	if len(saved) == 0 {
+		return nil, tx.Commit()
+	}
+
+	var history []received
+	for _, r := range batch {
+		if written[r.order.OrderUID] {
+			history = append(history, r)
+		}
+	}
+	if err := recordHistory(ctx, tx, history); err != nil {
+		return nil, err
+	}
+
+	err = insertRows(ctx, tx, `
 		INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		VALUES `, deliveryRows, `
 		ON CONFLICT (order_uid) DO UPDATE SET
 			name = EXCLUDED.name,
 			phone = EXCLUDED.phone,
@@ -107,17 +394,15 @@ func (s *orderService) saveOrder(order *models.Order) error {
 			city = EXCLUDED.city,
 			address = EXCLUDED.address,
 			region = EXCLUDED.region,
-			email = EXCLUDED.email`,
-		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
-		order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+			email = EXCLUDED.email`)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO payment (transaction, order_uid, request_id, currency, provider, 
+	err = insertRows(ctx, tx, `
+		INSERT INTO payment (transaction, order_uid, request_id, currency, provider,
 			amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		VALUES `, paymentRows, `
 		ON CONFLICT (transaction) DO UPDATE SET
 			order_uid = EXCLUDED.order_uid,
 			request_id = EXCLUDED.request_id,
@@ -128,96 +413,103 @@ func (s *orderService) saveOrder(order *models.Order) error {
 			bank = EXCLUDED.bank,
 			delivery_cost = EXCLUDED.delivery_cost,
 			goods_total = EXCLUDED.goods_total,
-			custom_fee = EXCLUDED.custom_fee`,
-		order.Payment.Transaction, order.OrderUID, order.Payment.RequestID, order.Payment.Currency,
-		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank,
-		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
+			custom_fee = EXCLUDED.custom_fee`)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = tx.ExecContext(ctx, "DELETE FROM items WHERE order_uid = $1", order.OrderUID)
+	_, err = tx.ExecContext(ctx, "DELETE FROM items WHERE order_uid = ANY($1)", pq.Array(uids))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, item := range order.Items {
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, 
-				sale, size, total_price, nm_id, brand, status)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
-			order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name,
-			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
-		if err != nil {
-			return err
-		}
+	err = insertRows(ctx, tx, `
+		INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name,
+			sale, size, total_price, nm_id, brand, status)
+		VALUES `, itemRows, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recordEvents(ctx, tx, saved, inserted); err != nil {
+		return nil, err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return saved, nil
 }
 
-func (s *orderService) RestoreCache() error {
-	rows, err := s.db.Query(`
-		SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
-			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
-			d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
-			p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt,
-			p.bank, p.delivery_cost, p.goods_total, p.custom_fee
-		FROM orders o
-		LEFT JOIN delivery d ON o.order_uid = d.order_uid
-		LEFT JOIN payment p ON o.order_uid = p.order_uid
-	`)
+// queryUIDs runs an upsert returning (order_uid, inserted) and records the
+// orders it wrote and which of them are new.
+func queryUIDs(ctx context.Context, tx *sql.Tx, stmt statement, written, inserted map[string]bool) error {
+	rows, err := tx.QueryContext(ctx, stmt.query, stmt.args...)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var order models.Order
-		var delivery models.Delivery
-		var payment models.Payment
-
-		err := rows.Scan(
-			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
-			&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard,
-			&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City, &delivery.Address, &delivery.Region, &delivery.Email,
-			&payment.Transaction, &payment.RequestID, &payment.Currency, &payment.Provider, &payment.Amount, &payment.PaymentDt,
-			&payment.Bank, &payment.DeliveryCost, &payment.GoodsTotal, &payment.CustomFee,
-		)
-		if err != nil {
+		var uid string
+		var isNew bool
+		if err := rows.Scan(&uid, &isNew); err != nil {
 			return err
 		}
+		written[uid] = true
+		inserted[uid] = isNew
+	}
+	return rows.Err()
+}
 
-		order.Delivery = delivery
-		order.Payment = payment
+// maxParams is the Postgres limit of bind parameters per statement.
+const maxParams = 65535
 
-		itemRows, err := s.db.Query(`
-			SELECT chrt_id, track_number, price, rid, name, sale, size, 
-				total_price, nm_id, brand, status
-			FROM items WHERE order_uid = $1`, order.OrderUID)
-		if err != nil {
-			return err
-		}
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+// buildInserts renders head, one VALUES tuple per row and tail, splitting
+// the rows over several statements when they exceed maxParams.
+func buildInserts(head string, rows [][]interface{}, tail string) []statement {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var stmts []statement
+	perStatement := maxParams / len(rows[0])
+	for start := 0; start < len(rows); start += perStatement {
+		end := min(start+perStatement, len(rows))
 
-		var items []models.Item
-		for itemRows.Next() {
-			var item models.Item
-			err := itemRows.Scan(
-				&item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale,
-				&item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status,
-			)
-			if err != nil {
-				itemRows.Close()
-				return err
+		var query strings.Builder
+		var args []interface{}
+		query.WriteString(head)
+		for i, row := range rows[start:end] {
+			if i > 0 {
+				query.WriteString(", ")
 			}
-			items = append(items, item)
+			query.WriteByte('(')
+			for j, value := range row {
+				if j > 0 {
+					query.WriteString(", ")
+				}
+				args = append(args, value)
+				fmt.Fprintf(&query, "$%d", len(args))
+			}
+			query.WriteByte(')')
 		}
-		itemRows.Close()
-
-		order.Items = items
-		s.cache.Set(order.OrderUID, &order)
+		query.WriteString(tail)
+		stmts = append(stmts, statement{query: query.String(), args: args})
 	}
+	return stmts
+}
 
-	log.Printf("Cache restored with %d orders", s.cache.Size())
+func insertRows(ctx context.Context, tx *sql.Tx, head string, rows [][]interface{}, tail string) error {
+	for _, stmt := range buildInserts(head, rows, tail) {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
 	return nil
-}
\ No newline at end of file
+}
@@ -1,17 +1,19 @@
 package service
 
 import (
-	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"testing"
 	"time"
 
 	"order-service/internal/cache"
+	"order-service/internal/consistency"
+	"order-service/internal/metrics"
 	"order-service/internal/models"
 
 	"github.com/DATA-DOG/go-sqlmock"
-	"github.com/nats-io/stan.go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,52 +23,28 @@ func TestProcessMessage_ValidJSON(t *testing.T) {
 	defer db.Close()
 
 	cache := cache.New()
-	stanConn := &mockStanConn{}
+	service := New(db, cache)
 
-	service := New(db, cache, stanConn)
-
-	order := models.Order{
-		OrderUID:    "test-123",
-		TrackNumber: "TRACK123",
-		Entry:       "WBIL",
-		Locale:      "en",
-		CustomerID:  "test",
-		DateCreated: time.Now(),
-		Delivery: models.Delivery{
-			Name:    "Test",
-			Phone:   "+123456789",
-			Zip:     "123456",
-			City:    "Moscow",
-			Address: "Test Address",
-			Region:  "Moscow",
-			Email:   "test@test.com",
-		},
-		Payment: models.Payment{
-			Transaction: "test-transaction",
-			Currency:    "USD",
-			Provider:    "wbpay",
-			Amount:      1000,
-			PaymentDt:   1637907727,
-			Bank:        "bank",
-			DeliveryCost: 500,
-			GoodsTotal:  500,
-			CustomFee:   0,
-		},
-		Items: []models.Item{},
-	}
+	order := testOrder()
 
 	data, err := json.Marshal(order)
 	assert.NoError(t, err)
 
 	mock.ExpectBegin()
-	mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("INSERT INTO orders").WillReturnRows(savedRows(order.OrderUID))
+	expectHistory(mock)
 	mock.ExpectExec("INSERT INTO delivery").WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec("INSERT INTO payment").WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec("DELETE FROM items").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO items").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO outbox").
+		WithArgs(models.EventOrderCreated, order.OrderUID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
-	err = service.ProcessMessage(data)
+	err = service.ProcessMessage(Message{Data: data})
 	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
 
 	cachedOrder, exists := cache.Get(order.OrderUID)
 	assert.True(t, exists)
@@ -79,13 +57,12 @@ func TestProcessMessage_InvalidJSON(t *testing.T) {
 	defer db.Close()
 
 	cache := cache.New()
-	stanConn := &mockStanConn{}
-
-	service := New(db, cache, stanConn)
+	service := New(db, cache)
 
 	invalidJSON := []byte(`{invalid json}`)
-	err = service.ProcessMessage(invalidJSON)
+	err = service.ProcessMessage(Message{Data: invalidJSON})
 	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrInvalidMessage))
 }
 
 func TestProcessMessage_MissingOrderUID(t *testing.T) {
@@ -94,29 +71,251 @@ func TestProcessMessage_MissingOrderUID(t *testing.T) {
 	defer db.Close()
 
 	cache := cache.New()
-	stanConn := &mockStanConn{}
-
-	service := New(db, cache, stanConn)
+	service := New(db, cache)
 
 	order := map[string]interface{}{
 		"track_number": "TRACK123",
 	}
 	data, _ := json.Marshal(order)
 
-	err = service.ProcessMessage(data)
+	err = service.ProcessMessage(Message{Data: data})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "order_uid is required")
+	assert.True(t, errors.Is(err, ErrInvalidMessage))
 }
 
-func TestGetOrder(t *testing.T) {
-	db, _, err := sqlmock.New()
+func TestProcessMessage_ValidationError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := New(db, cache.New())
+
+	order := testOrder()
+	order.Delivery.Email = "not-an-email"
+	order.Payment.Amount = -1
+	data, _ := json.Marshal(order)
+
+	failedBefore := testutil.ToFloat64(metrics.MessagesFailed.WithLabelValues(metrics.ReasonValidation))
+
+	err = service.ProcessMessage(Message{Data: data})
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrInvalidMessage))
+	assert.Equal(t, failedBefore+1, testutil.ToFloat64(metrics.MessagesFailed.WithLabelValues(metrics.ReasonValidation)))
+	assert.Contains(t, err.Error(), "delivery.email")
+	assert.Contains(t, err.Error(), "payment.amount")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessMessage_ConsistencyReject(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rules := consistency.New(map[string]consistency.Action{"goods_total": consistency.Reject})
+	service := New(db, cache.New(), WithConsistencyRules(rules))
+
+	order := testOrder()
+	order.Payment.GoodsTotal = 700
+	data, _ := json.Marshal(order)
+
+	err = service.ProcessMessage(Message{Data: data})
+	assert.True(t, errors.Is(err, ErrInvalidMessage))
+	assert.Contains(t, err.Error(), "goods_total")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessMessage_ConsistencyFlag(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	rules := consistency.New(map[string]consistency.Action{
+		"payment_amount":   consistency.Flag,
+		"item_total_price": consistency.Warn,
+	})
+	service := New(db, cache, WithConsistencyRules(rules))
+
+	// The warned violation is only logged.
+	order := testOrder()
+	order.Payment.Amount = 999
+	order.Items[0].TotalPrice++
+	data, _ := json.Marshal(order)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO orders").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			violationsArg{rule: "payment_amount"}, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(savedRows(order.OrderUID))
+	expectHistory(mock)
+	mock.ExpectExec("INSERT INTO delivery").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO payment").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM items").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO items").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = service.ProcessMessage(Message{Data: data})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	cached, _ := cache.Get(order.OrderUID)
+	assert.Len(t, cached.Violations, 1)
+	assert.Equal(t, "payment_amount", cached.Violations[0].Rule)
+	assert.Equal(t, "flag", cached.Violations[0].Action)
+}
+
+func TestProcessMessage_DuplicateSkipped(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	order := testOrder()
+	data, _ := json.Marshal(order)
+	msg := Message{Data: data, Stream: "stan/orders", Sequence: 7}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO orders").
+		WithArgs(anyArgs(12, "stan/orders", uint64(7), sqlmock.AnyArg())...).
+		WillReturnRows(savedRows(order.OrderUID))
+	expectHistory(mock)
+	mock.ExpectExec("INSERT INTO delivery").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO payment").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM items").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO items").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.ProcessMessage(msg))
+
+	skippedBefore := testutil.ToFloat64(metrics.MessagesSkipped.WithLabelValues(metrics.SkipDuplicate))
+	assert.NoError(t, service.ProcessMessage(msg))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, skippedBefore+1, testutil.ToFloat64(metrics.MessagesSkipped.WithLabelValues(metrics.SkipDuplicate)))
+}
+
+func TestProcessMessage_StaleSkipped(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	current := testOrder()
+	current.SourceStream = "stan/orders"
+	current.SourceSeq = 10
+	cache.Set(current.OrderUID, &current)
+
+	older := testOrder()
+	older.TrackNumber = "OLDTRACK"
+	data, _ := json.Marshal(older)
+
+	assert.NoError(t, service.ProcessMessage(Message{Data: data, Stream: "stan/orders", Sequence: 9}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	cached, _ := cache.Get(current.OrderUID)
+	assert.Equal(t, "TRACK123", cached.TrackNumber)
+}
+
+func TestProcessMessage_StaleInDatabase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	data, _ := json.Marshal(testOrder())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO orders .* WHERE orders.payload_hash <> EXCLUDED.payload_hash").
+		WillReturnRows(savedRows())
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.ProcessMessage(Message{Data: data, Stream: "stan/orders", Sequence: 3}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 0, cache.Size())
+}
+
+func TestProcessMessage_DatabaseError(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
 	cache := cache.New()
-	stanConn := &mockStanConn{}
+	service := New(db, cache)
+
+	data, _ := json.Marshal(testOrder())
+
+	mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+
+	err = service.ProcessMessage(Message{Data: data})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrInvalidMessage))
+
+	_, exists := cache.Get("test-123")
+	assert.False(t, exists)
+}
+
+func TestDeadLetter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	publisher := &mockPublisher{}
+	service := New(db, cache.New(), WithDeadLetterPublisher(publisher, "orders-dead-letter"))
+
+	letter := &models.DeadLetter{
+		Channel:    "orders",
+		Sequence:   42,
+		Reason:     "invalid message: order_uid is required",
+		Payload:    []byte(`{"track_number":"TRACK123"}`),
+		ReceivedAt: time.Now(),
+	}
+
+	mock.ExpectExec("INSERT INTO dead_letters (.+) ON CONFLICT \\(channel, sequence, md5\\(payload\\)\\) DO NOTHING").
+		WithArgs(letter.Channel, letter.Sequence, letter.Reason, letter.Payload, letter.ReceivedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = service.DeadLetter(letter)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
 
-	service := New(db, cache, stanConn)
+	assert.Len(t, publisher.published["orders-dead-letter"], 1)
+	var published models.DeadLetter
+	assert.NoError(t, json.Unmarshal(publisher.published["orders-dead-letter"][0], &published))
+	assert.Equal(t, letter.Payload, published.Payload)
+	assert.Equal(t, letter.Sequence, published.Sequence)
+}
+
+func TestDeadLetter_StoreError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	publisher := &mockPublisher{}
+	service := New(db, cache.New(), WithDeadLetterPublisher(publisher, "orders-dead-letter"))
+
+	mock.ExpectExec("INSERT INTO dead_letters").WillReturnError(errors.New("connection refused"))
+
+	err = service.DeadLetter(&models.DeadLetter{Channel: "orders", Sequence: 1})
+	assert.Error(t, err)
+	assert.Empty(t, publisher.published)
+}
+
+func TestGetOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
 
 	testOrder := &models.Order{
 		OrderUID:    "test-123",
@@ -129,8 +328,55 @@ func TestGetOrder(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, testOrder.OrderUID, order.OrderUID)
 
+	mock.ExpectQuery("SELECT (.+) FROM orders o").
+		WithArgs("nonexistent").
+		WillReturnRows(sqlmock.NewRows(orderColumns))
+
 	_, err = service.GetOrder("nonexistent")
+	assert.True(t, errors.Is(err, ErrOrderNotFound))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetOrder_ReadThrough(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := cache.New()
+	service := New(db, cache)
+
+	order := testOrder()
+	mock.ExpectQuery("SELECT (.+) FROM orders o").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(orderRow(order)...))
+	mock.ExpectQuery("SELECT (.+) FROM items").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows(itemColumns).AddRow(itemRow(order.Items[0])...))
+
+	loaded, err := service.GetOrder(order.OrderUID)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, order.Payment.Transaction, loaded.Payment.Transaction)
+	assert.Equal(t, order.Delivery.Email, loaded.Delivery.Email)
+	assert.Equal(t, order.Items, loaded.Items)
+
+	cached, exists := cache.Get(order.OrderUID)
+	assert.True(t, exists)
+	assert.Same(t, loaded, cached)
+}
+
+func TestGetOrder_DatabaseError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := New(db, cache.New())
+
+	mock.ExpectQuery("SELECT (.+) FROM orders o").WillReturnError(errors.New("connection refused"))
+
+	_, err = service.GetOrder("test-123")
 	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrOrderNotFound))
 }
 
 func TestGetCacheSize(t *testing.T) {
@@ -139,9 +385,7 @@ func TestGetCacheSize(t *testing.T) {
 	defer db.Close()
 
 	cache := cache.New()
-	stanConn := &mockStanConn{}
-
-	service := New(db, cache, stanConn)
+	service := New(db, cache)
 
 	assert.Equal(t, 0, service.GetCacheSize())
 
@@ -151,38 +395,128 @@ func TestGetCacheSize(t *testing.T) {
 	assert.Equal(t, 2, service.GetCacheSize())
 }
 
-type mockStanConn struct{}
+var orderColumns = []string{
+	"order_uid", "track_number", "entry", "locale", "internal_signature",
+	"customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
+	"violations", "source_stream", "source_seq", "payload_hash",
+	"name", "phone", "zip", "city", "address", "region", "email",
+	"transaction", "request_id", "currency", "provider", "amount", "payment_dt",
+	"bank", "delivery_cost", "goods_total", "custom_fee",
+}
 
-func (m *mockStanConn) Publish(subject string, data []byte) error {
-	return nil
+var itemColumns = []string{
+	"chrt_id", "track_number", "price", "rid", "name", "sale", "size",
+	"total_price", "nm_id", "brand", "status",
 }
 
-func (m *mockStanConn) PublishAsync(subject string, data []byte, ah stan.AckHandler) (string, error) {
-	return "", nil
+func expectHistory(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT DISTINCT ON \\(order_uid\\) order_uid, payload FROM order_history").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "payload"}))
+	mock.ExpectExec("INSERT INTO order_history").WillReturnResult(sqlmock.NewResult(1, 1))
 }
 
-func (m *mockStanConn) Subscribe(subject string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
-	return &mockSubscription{}, nil
+// savedRows is the upsert result for newly inserted orders.
+func savedRows(uids ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"order_uid", "inserted"})
+	for _, uid := range uids {
+		rows.AddRow(uid, true)
+	}
+	return rows
 }
 
-func (m *mockStanConn) QueueSubscribe(subject, qgroup string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
-	return &mockSubscription{}, nil
+func orderRow(o models.Order) []driver.Value {
+	d, p := o.Delivery, o.Payment
+	return []driver.Value{
+		o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature,
+		o.CustomerID, o.DeliveryService, o.Shardkey, o.SmID, o.DateCreated, o.OofShard,
+		[]byte("[]"), o.SourceStream, o.SourceSeq, o.PayloadHash,
+		d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email,
+		p.Transaction, p.RequestID, p.Currency, p.Provider, p.Amount, p.PaymentDt,
+		p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee,
+	}
 }
 
-func (m *mockStanConn) Close() error {
-	return nil
+func itemRow(i models.Item) []driver.Value {
+	return []driver.Value{
+		i.ChrtID, i.TrackNumber, i.Price, i.Rid, i.Name, i.Sale, i.Size,
+		i.TotalPrice, i.NmID, i.Brand, i.Status,
+	}
 }
 
-func (m *mockStanConn) NatsConn() stan.Conn {
-	return nil
+type violationsArg struct {
+	rule string
 }
 
-type mockSubscription struct{}
+func (a violationsArg) Match(v driver.Value) bool {
+	data, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+	var violations []models.RuleViolation
+	if err := json.Unmarshal(data, &violations); err != nil {
+		return false
+	}
+	return len(violations) == 1 && violations[0].Rule == a.rule
+}
 
-func (m *mockSubscription) Unsubscribe() error {
-	return nil
+func testOrder() models.Order {
+	return models.Order{
+		OrderUID:        "test-123",
+		TrackNumber:     "TRACK123",
+		Entry:           "WBIL",
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		OofShard:        "1",
+		DateCreated:     time.Now(),
+		Delivery: models.Delivery{
+			Name:    "Test",
+			Phone:   "+123456789",
+			Zip:     "123456",
+			City:    "Moscow",
+			Address: "Test Address",
+			Region:  "Moscow",
+			Email:   "test@test.com",
+		},
+		Payment: models.Payment{
+			Transaction:  "test-transaction",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1000,
+			PaymentDt:    1637907727,
+			Bank:         "bank",
+			DeliveryCost: 500,
+			GoodsTotal:   500,
+			CustomFee:    0,
+		},
+		Items: []models.Item{
+			{
+				ChrtID:      9934930,
+				TrackNumber: "TRACK123",
+				Price:       500,
+				Rid:         "test-rid",
+				Name:        "Mascaras",
+				Sale:        0,
+				Size:        "0",
+				TotalPrice:  500,
+				NmID:        2389212,
+				Brand:       "Vivienne Sabo",
+				Status:      202,
+			},
+		},
+	}
+}
+
+type mockPublisher struct {
+	published map[string][][]byte
 }
 
-func (m *mockSubscription) Close() error {
+func (m *mockPublisher) Publish(subject string, data []byte) error {
+	if m.published == nil {
+		m.published = make(map[string][][]byte)
+	}
+	m.published[subject] = append(m.published[subject], data)
 	return nil
-}
\ No newline at end of file
+}
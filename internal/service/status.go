@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"order-service/internal/metrics"
+	"order-service/internal/models"
+	"time"
+)
+
+// ProcessStatusEvent moves an order to the status of the event. Redelivered
+// and out-of-order events for an earlier stage are skipped; transitions the
+// lifecycle does not allow are rejected as invalid. Events for orders that
+// are not stored yet fail and are redelivered, since orders arrive on
+// another channel and may lag behind; the source dead-letters them on the
+// last delivery.
+func (s *orderService) ProcessStatusEvent(msg Message) error {
+	var event models.StatusEvent
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		return failed(metrics.ReasonInvalidJSON, fmt.Errorf("%w: invalid JSON: %v", ErrInvalidMessage, err))
+	}
+	if event.OrderUID == "" {
+		return failed(metrics.ReasonValidation, fmt.Errorf("%w: order_uid is required", ErrInvalidMessage))
+	}
+	if !event.Status.Valid() {
+		return failed(metrics.ReasonValidation, fmt.Errorf("%w: unknown status %q", ErrInvalidMessage, event.Status))
+	}
+	if event.ChangedAt.IsZero() {
+		event.ChangedAt = msg.ReceivedAt
+	}
+	if event.ChangedAt.IsZero() {
+		event.ChangedAt = time.Now()
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return failed(metrics.ReasonDatabase, fmt.Errorf("failed to begin transaction: %v", err))
+	}
+	defer tx.Rollback()
+
+	var current models.OrderStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE order_uid = $1 FOR UPDATE`,
+		event.OrderUID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("status %s for unknown order %s: %w", event.Status, event.OrderUID, ErrOrderNotFound)
+	}
+	if err != nil {
+		return failed(metrics.ReasonDatabase, fmt.Errorf("failed to load order status: %v", err))
+	}
+
+	switch {
+	case current == event.Status:
+		statusSkipped(event, metrics.SkipDuplicate)
+		return nil
+	case event.Status.Precedes(current):
+		statusSkipped(event, metrics.SkipStale)
+		return nil
+	case !current.CanTransition(event.Status):
+		return failed(metrics.ReasonTransition, fmt.Errorf("%w: order %s cannot change status from %s to %s",
+			ErrInvalidMessage, event.OrderUID, current, event.Status))
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE orders SET status = $2 WHERE order_uid = $1`,
+		event.OrderUID, event.Status); err != nil {
+		return failed(metrics.ReasonDatabase, fmt.Errorf("failed to update order status: %v", err))
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO order_status_transitions (order_uid, from_status, to_status, changed_at, source_stream, source_seq)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		event.OrderUID, current, event.Status, event.ChangedAt, msg.Stream, msg.Sequence)
+	if err != nil {
+		return failed(metrics.ReasonDatabase, fmt.Errorf("failed to record status transition: %v", err))
+	}
+	if err := tx.Commit(); err != nil {
+		return failed(metrics.ReasonDatabase, fmt.Errorf("failed to commit status transition: %v", err))
+	}
+
+	metrics.StatusTransitions.WithLabelValues(string(current), string(event.Status)).Inc()
+	log.Printf("Order %s status changed from %s to %s", event.OrderUID, current, event.Status)
+	return nil
+}
+
+func statusSkipped(event models.StatusEvent, reason string) {
+	metrics.MessagesSkipped.WithLabelValues(reason).Inc()
+	log.Printf("Order %s status %s skipped: %s", event.OrderUID, event.Status, reason)
+}
+
+// GetOrderStatus returns the current status of an order and its timeline,
+// which starts with the creation of the order.
+func (s *orderService) GetOrderStatus(orderUID string) (*models.StatusTimeline, error) {
+	var created time.Time
+	timeline := &models.StatusTimeline{OrderUID: orderUID}
+	err := s.db.QueryRow(`SELECT status, date_created FROM orders WHERE order_uid = $1`, orderUID).
+		Scan(&timeline.Status, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order status: %v", err)
+	}
+	timeline.Timeline = []models.StatusTransition{{To: models.StatusCreated, ChangedAt: created}}
+
+	rows, err := s.db.Query(`
+		SELECT from_status, to_status, changed_at, recorded_at
+		FROM order_status_transitions WHERE order_uid = $1 ORDER BY id`, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load status transitions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.StatusTransition
+		if err := rows.Scan(&t.From, &t.To, &t.ChangedAt, &t.RecordedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan status transition: %v", err)
+		}
+		timeline.Timeline = append(timeline.Timeline, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load status transitions: %v", err)
+	}
+	return timeline, nil
+}
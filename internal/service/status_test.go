@@ -0,0 +1,121 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"order-service/internal/cache"
+	"order-service/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func statusMessage(data string) Message {
+	return Message{Data: []byte(data), Stream: "stan/order-status", Sequence: 3, ReceivedAt: time.Now()}
+}
+
+func TestProcessStatusEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := New(db, cache.New())
+	changedAt := time.Date(2021, 11, 26, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT status FROM orders WHERE order_uid = \\$1 FOR UPDATE").
+		WithArgs("test-123").
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("created"))
+	mock.ExpectExec("UPDATE orders SET status").
+		WithArgs("test-123", models.StatusPaid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO order_status_transitions").
+		WithArgs("test-123", models.StatusCreated, models.StatusPaid, changedAt, "stan/order-status", uint64(3)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = service.ProcessStatusEvent(statusMessage(
+		`{"order_uid":"test-123","status":"paid","changed_at":"2021-11-26T10:00:00Z"}`))
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessStatusEvent_Skipped(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := New(db, cache.New())
+
+	for _, current := range []string{"paid", "assembling"} {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT status FROM orders").
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(current))
+		mock.ExpectRollback()
+
+		assert.NoError(t, service.ProcessStatusEvent(statusMessage(`{"order_uid":"test-123","status":"paid"}`)))
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessStatusEvent_Rejected(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := New(db, cache.New())
+
+	err = service.ProcessStatusEvent(statusMessage(`{"order_uid":"test-123","status":"lost"}`))
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT status FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("created"))
+	mock.ExpectRollback()
+
+	err = service.ProcessStatusEvent(statusMessage(`{"order_uid":"test-123","status":"shipped"}`))
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+	assert.Contains(t, err.Error(), "from created to shipped")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT status FROM orders").WillReturnRows(sqlmock.NewRows([]string{"status"}))
+	mock.ExpectRollback()
+
+	err = service.ProcessStatusEvent(statusMessage(`{"order_uid":"missing","status":"paid"}`))
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+	assert.NotErrorIs(t, err, ErrInvalidMessage)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetOrderStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	service := New(db, cache.New())
+	created := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	paid := created.Add(time.Hour)
+
+	mock.ExpectQuery("SELECT status, date_created FROM orders").
+		WithArgs("test-123").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "date_created"}).AddRow("paid", created))
+	mock.ExpectQuery("FROM order_status_transitions WHERE order_uid = \\$1 ORDER BY id").
+		WithArgs("test-123").
+		WillReturnRows(sqlmock.NewRows([]string{"from_status", "to_status", "changed_at", "recorded_at"}).
+			AddRow("created", "paid", paid, paid))
+
+	timeline, err := service.GetOrderStatus("test-123")
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusPaid, timeline.Status)
+	assert.Equal(t, []models.StatusTransition{
+		{To: models.StatusCreated, ChangedAt: created},
+		{From: models.StatusCreated, To: models.StatusPaid, ChangedAt: paid, RecordedAt: paid},
+	}, timeline.Timeline)
+
+	mock.ExpectQuery("SELECT status, date_created FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "date_created"}))
+	_, err = service.GetOrderStatus("missing")
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"order-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+const selectOrders = `
+	SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+		o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
+		o.violations, o.source_stream, o.source_seq, o.payload_hash,
+		d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+		p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt,
+		p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+	FROM orders o
+	LEFT JOIN delivery d ON o.order_uid = d.order_uid
+	LEFT JOIN payment p ON o.order_uid = p.order_uid`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOrder(row scanner) (*models.Order, error) {
+	var order models.Order
+	var delivery models.Delivery
+	var payment models.Payment
+	var violations []byte
+
+	err := row.Scan(
+		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
+		&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard,
+		&violations, &order.SourceStream, &order.SourceSeq, &order.PayloadHash,
+		&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City, &delivery.Address, &delivery.Region, &delivery.Email,
+		&payment.Transaction, &payment.RequestID, &payment.Currency, &payment.Provider, &payment.Amount, &payment.PaymentDt,
+		&payment.Bank, &payment.DeliveryCost, &payment.GoodsTotal, &payment.CustomFee,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(violations, &order.Violations); err != nil {
+		return nil, err
+	}
+	order.Delivery = delivery
+	order.Payment = payment
+	return &order, nil
+}
+
+func (s *orderService) loadOrder(orderUID string) (*models.Order, error) {
+	order, err := scanOrder(s.db.QueryRow(selectOrders+" WHERE o.order_uid = $1", orderUID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order: %v", err)
+	}
+
+	order.Items, err = s.loadItems(orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load items: %v", err)
+	}
+	return order, nil
+}
+
+func (s *orderService) loadItems(orderUID string) ([]models.Item, error) {
+	rows, err := s.db.Query(`
+		SELECT chrt_id, track_number, price, rid, name, sale, size,
+			total_price, nm_id, brand, status
+		FROM items WHERE order_uid = $1 ORDER BY id`, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.Item
+	for rows.Next() {
+		var item models.Item
+		err := rows.Scan(
+			&item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale,
+			&item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *orderService) loadItemsBatch(orderUIDs []string) (map[string][]models.Item, error) {
+	rows, err := s.db.Query(`
+		SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size,
+			total_price, nm_id, brand, status
+		FROM items WHERE order_uid = ANY($1) ORDER BY id`, pq.Array(orderUIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[string][]models.Item, len(orderUIDs))
+	for rows.Next() {
+		var item models.Item
+		err := rows.Scan(
+			&item.OrderUID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale,
+			&item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items[item.OrderUID] = append(items[item.OrderUID], item)
+	}
+	return items, rows.Err()
+}
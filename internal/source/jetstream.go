@@ -0,0 +1,263 @@
+package source
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// setupTimeout bounds the JetStream API calls made while connecting and
+// publishing.
+const setupTimeout = 10 * time.Second
+
+type JetStreamConfig struct {
+	// Source tells apart several JetStream sources in logs, metrics and
+	// messages; it is "jetstream" by default.
+	Source  string
+	URL     string
+	Name    string
+	Stream  string
+	Subject string
+	// DeadLetterSubject is added to the stream so that published dead
+	// letters are persisted next to the orders.
+	DeadLetterSubject string
+	// ExtraSubjects are added to the stream for the same reason: the events
+	// published by the outbox relay and the order status events.
+	ExtraSubjects []string
+	// FilterSubject is the subject the durable consumer reads, Subject by
+	// default. Sources sharing a stream must be configured with the same
+	// subjects and differ only in FilterSubject and Durable.
+	FilterSubject string
+	Durable       string
+	AckWait       time.Duration
+	MaxDeliver    int
+	MaxAckPending int
+	ReconnectWait time.Duration
+	// RetryMin and RetryMax bound the redelivery delay of nacked messages,
+	// doubled on every delivery, so that a short outage does not use up
+	// MaxDeliver at once.
+	RetryMin time.Duration
+	RetryMax time.Duration
+}
+
+func (c JetStreamConfig) streamConfig() jetstream.StreamConfig {
+	subjects := []string{c.Subject}
+	if c.DeadLetterSubject != "" {
+		subjects = append(subjects, c.DeadLetterSubject)
+	}
+	subjects = append(subjects, c.ExtraSubjects...)
+	return jetstream.StreamConfig{
+		Name:     c.Stream,
+		Subjects: subjects,
+		Storage:  jetstream.FileStorage,
+	}
+}
+
+func (c JetStreamConfig) consumerConfig() jetstream.ConsumerConfig {
+	filter := c.FilterSubject
+	if filter == "" {
+		filter = c.Subject
+	}
+	return jetstream.ConsumerConfig{
+		Durable:       c.Durable,
+		FilterSubject: filter,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       c.AckWait,
+		MaxDeliver:    c.MaxDeliver,
+		MaxAckPending: c.MaxAckPending,
+	}
+}
+
+// JetStream consumes a durable pull consumer with explicit acks. The NATS
+// client reconnects on its own and the consumer keeps pulling afterwards;
+// messages that are not acked are redelivered up to MaxDeliver times.
+type JetStream struct {
+	cfg JetStreamConfig
+
+	mu       sync.Mutex
+	nc       *nats.Conn
+	js       jetstream.JetStream
+	consumer jetstream.Consumer
+	consume  jetstream.ConsumeContext
+	state    string
+}
+
+func NewJetStream(cfg JetStreamConfig) *JetStream {
+	return &JetStream{cfg: cfg}
+}
+
+func (s *JetStream) Name() string {
+	return s.cfg.source()
+}
+
+func (c JetStreamConfig) source() string {
+	if c.Source == "" {
+		return "jetstream"
+	}
+	return c.Source
+}
+
+func (s *JetStream) Connect() error {
+	nc, err := nats.Connect(s.cfg.URL,
+		nats.Name(s.cfg.Name),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(s.cfg.ReconnectWait),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("JetStream connection lost: %v", err)
+			}
+			s.setState(StateReconnecting)
+		}),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			s.setState(StateConnected)
+		}),
+		nats.ClosedHandler(func(*nats.Conn) {
+			s.setState(StateClosed)
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+	defer cancel()
+
+	if _, err := js.CreateOrUpdateStream(ctx, s.cfg.streamConfig()); err != nil {
+		nc.Close()
+		return err
+	}
+	consumer, err := js.CreateOrUpdateConsumer(ctx, s.cfg.Stream, s.cfg.consumerConfig())
+	if err != nil {
+		nc.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	s.nc, s.js, s.consumer = nc, js, consumer
+	s.mu.Unlock()
+
+	s.setState(StateConnected)
+	return nil
+}
+
+func (s *JetStream) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *JetStream) setState(state string) {
+	s.mu.Lock()
+	changed := s.state != state
+	s.state = state
+	s.mu.Unlock()
+
+	if changed {
+		recordState(s.Name(), state)
+	}
+}
+
+func (s *JetStream) Start(handler Handler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.consumer == nil {
+		return errNotConnected
+	}
+
+	consume, err := s.consumer.Consume(func(msg jetstream.Msg) {
+		handler(s.cfg.message(msg))
+	},
+		jetstream.PullMaxMessages(s.cfg.MaxAckPending),
+		jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+			log.Printf("JetStream consumer error: %v", err)
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	s.consume = consume
+	return nil
+}
+
+func (c JetStreamConfig) message(msg jetstream.Msg) *Message {
+	m := &Message{
+		Source:  c.source(),
+		Subject: msg.Subject(),
+		Data:    msg.Data(),
+		ack:     msg.Ack,
+		nak:     msg.Nak,
+	}
+	if meta, err := msg.Metadata(); err == nil {
+		m.Sequence = meta.Sequence.Stream
+		m.Timestamp = meta.Timestamp
+		m.LastDelivery = c.MaxDeliver > 0 && meta.NumDelivered >= uint64(c.MaxDeliver)
+		if delay := c.retryDelay(meta.NumDelivered); delay > 0 {
+			m.nak = func() error { return msg.NakWithDelay(delay) }
+		}
+	}
+	return m
+}
+
+// retryDelay is RetryMin after the first delivery, doubled for every
+// further one up to RetryMax.
+func (c JetStreamConfig) retryDelay(delivered uint64) time.Duration {
+	delay := c.RetryMin
+	for i := uint64(1); i < delivered && delay < c.RetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, max(c.RetryMax, c.RetryMin))
+}
+
+// Stop stops pulling but keeps the durable consumer on the server.
+// Buffered messages that were not handled yet are redelivered later.
+func (s *JetStream) Stop() error {
+	s.mu.Lock()
+	consume := s.consume
+	s.consume = nil
+	s.mu.Unlock()
+
+	if consume != nil {
+		consume.Stop()
+	}
+	return nil
+}
+
+func (s *JetStream) Publish(subject string, data []byte) error {
+	s.mu.Lock()
+	js := s.js
+	s.mu.Unlock()
+
+	if js == nil {
+		return errNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+	defer cancel()
+	_, err := js.Publish(ctx, subject, data)
+	return err
+}
+
+func (s *JetStream) Close() error {
+	s.mu.Lock()
+	nc := s.nc
+	s.nc, s.js, s.consumer, s.consume = nil, nil, nil, nil
+	s.mu.Unlock()
+
+	if nc != nil {
+		nc.Close()
+	}
+	s.setState(StateClosed)
+	return nil
+}
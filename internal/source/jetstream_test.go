@@ -0,0 +1,117 @@
+package source
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeJetStreamMsg struct {
+	jetstream.Msg
+	acked, naked bool
+	delay        time.Duration
+}
+
+func (f *fakeJetStreamMsg) Subject() string { return "orders" }
+
+func (f *fakeJetStreamMsg) Data() []byte { return []byte("{}") }
+
+func (f *fakeJetStreamMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{
+		Sequence:     jetstream.SequencePair{Stream: 42, Consumer: 3},
+		NumDelivered: 2,
+		Timestamp:    time.Unix(100, 0),
+	}, nil
+}
+
+func (f *fakeJetStreamMsg) Ack() error {
+	f.acked = true
+	return nil
+}
+
+func (f *fakeJetStreamMsg) Nak() error {
+	f.naked = true
+	return nil
+}
+
+func (f *fakeJetStreamMsg) NakWithDelay(delay time.Duration) error {
+	f.naked = true
+	f.delay = delay
+	return nil
+}
+
+func TestJetStreamConfig(t *testing.T) {
+	cfg := JetStreamConfig{
+		Stream:            "ORDERS",
+		Subject:           "orders",
+		DeadLetterSubject: "orders-dead-letter",
+		Durable:           "order-service",
+		AckWait:           30 * time.Second,
+		MaxDeliver:        5,
+		MaxAckPending:     32,
+	}
+
+	stream := cfg.streamConfig()
+	assert.Equal(t, "ORDERS", stream.Name)
+	assert.Equal(t, []string{"orders", "orders-dead-letter"}, stream.Subjects)
+
+	consumer := cfg.consumerConfig()
+	assert.Equal(t, "order-service", consumer.Durable)
+	assert.Equal(t, "orders", consumer.FilterSubject)
+	assert.Equal(t, jetstream.AckExplicitPolicy, consumer.AckPolicy)
+	assert.Equal(t, 5, consumer.MaxDeliver)
+	assert.Equal(t, 32, consumer.MaxAckPending)
+	assert.Equal(t, 30*time.Second, consumer.AckWait)
+
+	cfg.ExtraSubjects = []string{"order-status"}
+	cfg.FilterSubject = "order-status"
+	assert.Equal(t, []string{"orders", "orders-dead-letter", "order-status"}, cfg.streamConfig().Subjects)
+	assert.Equal(t, "order-status", cfg.consumerConfig().FilterSubject)
+}
+
+func TestJetStreamMessage(t *testing.T) {
+	raw := &fakeJetStreamMsg{}
+	msg := JetStreamConfig{}.message(raw)
+
+	assert.Equal(t, "orders", msg.Subject)
+	assert.Equal(t, uint64(42), msg.Sequence)
+	assert.Equal(t, []byte("{}"), msg.Data)
+	assert.True(t, time.Unix(100, 0).Equal(msg.Timestamp))
+
+	assert.NoError(t, msg.Nak())
+	assert.True(t, raw.naked)
+	assert.NoError(t, msg.Ack())
+	assert.True(t, raw.acked)
+	assert.Zero(t, raw.delay)
+	assert.False(t, msg.LastDelivery)
+}
+
+func TestJetStreamMessageRetries(t *testing.T) {
+	cfg := JetStreamConfig{MaxDeliver: 2, RetryMin: time.Second, RetryMax: 30 * time.Second}
+
+	// The fake message is on its second delivery.
+	raw := &fakeJetStreamMsg{}
+	msg := cfg.message(raw)
+	assert.True(t, msg.LastDelivery)
+	assert.NoError(t, msg.Nak())
+	assert.Equal(t, 2*time.Second, raw.delay)
+
+	cfg.MaxDeliver = 5
+	assert.False(t, cfg.message(raw).LastDelivery)
+
+	assert.Equal(t, time.Second, cfg.retryDelay(1))
+	assert.Equal(t, 8*time.Second, cfg.retryDelay(4))
+	assert.Equal(t, 30*time.Second, cfg.retryDelay(10))
+}
+
+func TestJetStreamNotConnected(t *testing.T) {
+	src := NewJetStream(JetStreamConfig{})
+
+	assert.ErrorIs(t, src.Start(func(*Message) {}), errNotConnected)
+	assert.ErrorIs(t, src.Publish("orders", nil), errNotConnected)
+	assert.NoError(t, src.Stop())
+	assert.NoError(t, src.Close())
+	assert.Equal(t, StateClosed, src.State())
+}
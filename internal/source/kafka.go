@@ -0,0 +1,337 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+	GroupID string
+	// MaxInflight is the number of fetched messages that may wait for an
+	// ack, across partitions.
+	MaxInflight int
+	RetryMin    time.Duration
+	RetryMax    time.Duration
+}
+
+type kafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Kafka consumes a topic as a member of a consumer group. Up to MaxInflight
+// messages are handled at once; the offset of a partition is committed up
+// to the last message acked with all earlier ones, so a restart resumes at
+// the first unacked message. Kafka has no per-message redelivery, so a
+// message that is not acked is handed over again after a backoff, without
+// holding up the messages behind it.
+type Kafka struct {
+	cfg       KafkaConfig
+	newReader func() kafkaReader
+
+	mu     sync.Mutex
+	reader kafkaReader
+	writer *kafka.Writer
+	cancel context.CancelFunc
+	done   chan struct{}
+	state  string
+}
+
+func NewKafka(cfg KafkaConfig) *Kafka {
+	return &Kafka{
+		cfg: cfg,
+		newReader: func() kafkaReader {
+			return kafka.NewReader(kafka.ReaderConfig{
+				Brokers: cfg.Brokers,
+				Topic:   cfg.Topic,
+				GroupID: cfg.GroupID,
+			})
+		},
+	}
+}
+
+func (s *Kafka) Name() string {
+	return "kafka"
+}
+
+// Connect checks that a broker is reachable; the reader itself connects
+// lazily and joins the group on the first fetch.
+func (s *Kafka) Connect() error {
+	if len(s.cfg.Brokers) == 0 {
+		return errors.New("no Kafka brokers configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+	defer cancel()
+
+	var err error
+	for _, broker := range s.cfg.Brokers {
+		var conn *kafka.Conn
+		if conn, err = kafka.DialContext(ctx, "tcp", broker); err == nil {
+			conn.Close()
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.reader = s.newReader()
+	s.writer = &kafka.Writer{
+		Addr:         kafka.TCP(s.cfg.Brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+	s.mu.Unlock()
+
+	s.setState(StateConnected)
+	return nil
+}
+
+func (s *Kafka) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *Kafka) setState(state string) {
+	s.mu.Lock()
+	changed := s.state != state
+	s.state = state
+	s.mu.Unlock()
+
+	if changed {
+		recordState(s.Name(), state)
+	}
+}
+
+func (s *Kafka) Start(handler Handler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reader == nil {
+		return errNotConnected
+	}
+	if s.cancel != nil {
+		return errors.New("kafka source already started")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.run(ctx, s.reader, handler, s.done)
+	return nil
+}
+
+// kafkaSession is the state of one Start: the fetched messages waiting for
+// an ack, per partition, and the retries in progress.
+type kafkaSession struct {
+	ctx        context.Context
+	reader     kafkaReader
+	handler    Handler
+	slots      chan struct{}
+	partitions map[int]*kafkaPartition
+	retries    sync.WaitGroup
+}
+
+// kafkaPartition holds the fetched messages of a partition in offset order
+// until they are committed.
+type kafkaPartition struct {
+	mu      sync.Mutex
+	pending []*kafkaPending
+}
+
+type kafkaPending struct {
+	msg   kafka.Message
+	acked bool
+}
+
+func (s *Kafka) run(ctx context.Context, reader kafkaReader, handler Handler, done chan struct{}) {
+	defer close(done)
+
+	session := &kafkaSession{
+		ctx:        ctx,
+		reader:     reader,
+		handler:    handler,
+		slots:      make(chan struct{}, max(s.cfg.MaxInflight, 1)),
+		partitions: make(map[int]*kafkaPartition),
+	}
+	defer session.retries.Wait()
+
+	backoff := s.cfg.RetryMin
+	for {
+		select {
+		case session.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			<-session.slots
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Kafka fetch failed: %v", err)
+			s.setState(StateReconnecting)
+			if !sleep(ctx, backoff) {
+				return
+			}
+			backoff = s.nextBackoff(backoff)
+			continue
+		}
+
+		s.setState(StateConnected)
+		backoff = s.cfg.RetryMin
+
+		part, exists := session.partitions[m.Partition]
+		if !exists {
+			part = &kafkaPartition{}
+			session.partitions[m.Partition] = part
+		}
+		pending := &kafkaPending{msg: m}
+		part.mu.Lock()
+		part.pending = append(part.pending, pending)
+		part.mu.Unlock()
+
+		s.deliver(session, part, pending, s.cfg.RetryMin)
+	}
+}
+
+// deliver hands the message to the handler, which may settle it
+// asynchronously. A nak hands it over again after backoff unless the source
+// stops meanwhile; the message is then fetched again after a restart.
+func (s *Kafka) deliver(session *kafkaSession, part *kafkaPartition, pending *kafkaPending, backoff time.Duration) {
+	session.handler(kafkaMessage(pending.msg, func() error {
+		// The commit must survive Stop, which cancels ctx while
+		// in-flight messages are still being drained.
+		ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+		defer cancel()
+		return part.ack(ctx, session, pending)
+	}, func() error {
+		session.retries.Add(1)
+		go func() {
+			defer session.retries.Done()
+			if sleep(session.ctx, backoff) {
+				s.deliver(session, part, pending, s.nextBackoff(backoff))
+			}
+		}()
+		return nil
+	}))
+}
+
+// ack marks the message acked and commits the offset of the last message
+// acked together with all earlier ones. A failed commit is retried by the
+// next ack of the partition, since commits are cumulative.
+func (p *kafkaPartition) ack(ctx context.Context, session *kafkaSession, pending *kafkaPending) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pending.acked {
+		return nil
+	}
+	pending.acked = true
+	<-session.slots
+
+	n := 0
+	for n < len(p.pending) && p.pending[n].acked {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	if err := session.reader.CommitMessages(ctx, p.pending[n-1].msg); err != nil {
+		return err
+	}
+	p.pending = p.pending[n:]
+	return nil
+}
+
+func (s *Kafka) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > s.cfg.RetryMax {
+		backoff = s.cfg.RetryMax
+	}
+	return backoff
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func kafkaMessage(m kafka.Message, ack, nak func() error) *Message {
+	return &Message{
+		Source:    "kafka",
+		Subject:   fmt.Sprintf("%s/%d", m.Topic, m.Partition),
+		Sequence:  uint64(m.Offset),
+		Data:      m.Value,
+		Timestamp: m.Time,
+		ack:       ack,
+		nak:       nak,
+	}
+}
+
+// Stop stops fetching. The group offsets stay on the brokers.
+func (s *Kafka) Stop() error {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	return nil
+}
+
+func (s *Kafka) Publish(subject string, data []byte) error {
+	s.mu.Lock()
+	writer := s.writer
+	s.mu.Unlock()
+
+	if writer == nil {
+		return errNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+	defer cancel()
+	return writer.WriteMessages(ctx, kafka.Message{Topic: subject, Value: data})
+}
+
+func (s *Kafka) Close() error {
+	s.Stop()
+
+	s.mu.Lock()
+	reader, writer, done := s.reader, s.writer, s.done
+	s.reader, s.writer = nil, nil
+	s.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+
+	var errs []error
+	if reader != nil {
+		errs = append(errs, reader.Close())
+	}
+	if writer != nil {
+		errs = append(errs, writer.Close())
+	}
+	s.setState(StateClosed)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,123 @@
+package source
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeReader struct {
+	mu        sync.Mutex
+	messages  chan kafka.Message
+	committed []int64
+	closed    bool
+}
+
+func (f *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case m := <-f.messages:
+		return m, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (f *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range msgs {
+		f.committed = append(f.committed, m.Offset)
+	}
+	return nil
+}
+
+func (f *fakeReader) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeReader) commits() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int64(nil), f.committed...)
+}
+
+func TestKafkaRetriesUntilAcked(t *testing.T) {
+	reader := &fakeReader{messages: make(chan kafka.Message, 2)}
+	src := &Kafka{
+		cfg:    KafkaConfig{MaxInflight: 2, RetryMin: time.Millisecond, RetryMax: 2 * time.Millisecond},
+		reader: reader,
+	}
+
+	var mu sync.Mutex
+	attempts := map[uint64]int{}
+	assert.NoError(t, src.Start(func(msg *Message) {
+		mu.Lock()
+		attempts[msg.Sequence]++
+		n := attempts[msg.Sequence]
+		mu.Unlock()
+
+		assert.Equal(t, "orders/1", msg.Subject)
+		if msg.Sequence == 10 && n < 3 {
+			msg.Nak()
+			return
+		}
+		// Messages may be settled after the handler returns.
+		go msg.Ack()
+	}))
+
+	reader.messages <- kafka.Message{Topic: "orders", Partition: 1, Offset: 10, Value: []byte("{}")}
+	reader.messages <- kafka.Message{Topic: "orders", Partition: 1, Offset: 11, Value: []byte("{}")}
+
+	// 11 is acked first but committed only once 10 is acked too.
+	assert.Eventually(t, func() bool {
+		return len(reader.commits()) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []int64{11}, reader.commits())
+
+	mu.Lock()
+	assert.Equal(t, 3, attempts[10])
+	assert.Equal(t, 1, attempts[11])
+	mu.Unlock()
+
+	assert.NoError(t, src.Close())
+	assert.True(t, reader.closed)
+	assert.Equal(t, StateClosed, src.State())
+}
+
+func TestKafkaCommitsInOrder(t *testing.T) {
+	reader := &fakeReader{}
+	session := &kafkaSession{reader: reader, slots: make(chan struct{}, 3)}
+	part := &kafkaPartition{}
+	var pending []*kafkaPending
+	for offset := int64(0); offset < 3; offset++ {
+		session.slots <- struct{}{}
+		pending = append(pending, &kafkaPending{msg: kafka.Message{Offset: offset}})
+	}
+	part.pending = pending
+
+	ctx := context.Background()
+	assert.NoError(t, part.ack(ctx, session, pending[1]))
+	assert.Empty(t, reader.commits())
+	assert.NoError(t, part.ack(ctx, session, pending[0]))
+	assert.Equal(t, []int64{1}, reader.commits())
+	assert.NoError(t, part.ack(ctx, session, pending[2]))
+	assert.NoError(t, part.ack(ctx, session, pending[2]))
+	assert.Equal(t, []int64{1, 2}, reader.commits())
+	assert.Empty(t, part.pending)
+	assert.Empty(t, session.slots)
+}
+
+func TestKafkaNotConnected(t *testing.T) {
+	src := NewKafka(KafkaConfig{})
+
+	assert.Error(t, src.Connect())
+	assert.ErrorIs(t, src.Start(func(*Message) {}), errNotConnected)
+	assert.ErrorIs(t, src.Publish("orders", nil), errNotConnected)
+}
@@ -0,0 +1,134 @@
+package source
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process MessageSource for tests. Deliver feeds it
+// messages and the acks, naks and publishes are recorded. Like stan, it
+// rejects acks once stopped.
+type Memory struct {
+	name string
+
+	mu        sync.Mutex
+	handler   Handler
+	stopped   bool
+	state     string
+	sequence  uint64
+	acked     []uint64
+	naked     []uint64
+	published map[string][][]byte
+}
+
+func NewMemory(name string) *Memory {
+	return &Memory{name: name, published: make(map[string][][]byte)}
+}
+
+func (s *Memory) Name() string {
+	return s.name
+}
+
+func (s *Memory) Connect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = StateConnected
+	return nil
+}
+
+func (s *Memory) Start(handler Handler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != StateConnected {
+		return errNotConnected
+	}
+	s.handler = handler
+	s.stopped = false
+	return nil
+}
+
+func (s *Memory) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = nil
+	s.stopped = true
+	return nil
+}
+
+func (s *Memory) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *Memory) Publish(subject string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published[subject] = append(s.published[subject], data)
+	return nil
+}
+
+func (s *Memory) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = nil
+	s.state = StateClosed
+	return nil
+}
+
+// Deliver passes data to the handler and returns its sequence number.
+func (s *Memory) Deliver(subject string, data []byte) (uint64, error) {
+	s.mu.Lock()
+	handler := s.handler
+	s.sequence++
+	seq := s.sequence
+	s.mu.Unlock()
+
+	if handler == nil {
+		return 0, errors.New("memory source not started")
+	}
+
+	handler(&Message{
+		Source:    s.name,
+		Subject:   subject,
+		Sequence:  seq,
+		Data:      data,
+		Timestamp: time.Now(),
+		ack: func() error {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.stopped {
+				return errors.New("subscription closed")
+			}
+			s.acked = append(s.acked, seq)
+			return nil
+		},
+		nak: func() error { s.record(&s.naked, seq); return nil },
+	})
+	return seq, nil
+}
+
+func (s *Memory) record(list *[]uint64, seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*list = append(*list, seq)
+}
+
+func (s *Memory) Acked() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint64(nil), s.acked...)
+}
+
+func (s *Memory) Naked() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint64(nil), s.naked...)
+}
+
+func (s *Memory) Published(subject string) [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.published[subject]...)
+}
@@ -0,0 +1,30 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySource(t *testing.T) {
+	src := NewMemory("memory")
+	_, err := src.Deliver("orders", nil)
+	assert.Error(t, err)
+
+	assert.NoError(t, src.Connect())
+	assert.NoError(t, src.Start(func(msg *Message) {
+		if len(msg.Data) == 0 {
+			msg.Nak()
+			return
+		}
+		msg.Ack()
+	}))
+
+	first, _ := src.Deliver("orders", []byte("{}"))
+	second, _ := src.Deliver("orders", nil)
+	assert.Equal(t, []uint64{first}, src.Acked())
+	assert.Equal(t, []uint64{second}, src.Naked())
+
+	assert.NoError(t, src.Publish("dead", []byte("x")))
+	assert.Len(t, src.Published("dead"), 1)
+}
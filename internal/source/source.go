@@ -0,0 +1,78 @@
+// Package source delivers order messages from a broker and hides whether
+// they come from NATS Streaming, JetStream or Kafka.
+package source
+
+import (
+	"errors"
+	"log"
+	"order-service/internal/metrics"
+	"time"
+)
+
+// Connection states reported by State.
+const (
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateClosed       = "closed"
+)
+
+var errNotConnected = errors.New("not connected")
+
+// Message is a single delivery. It must be acked once processed; otherwise
+// the broker redelivers it.
+type Message struct {
+	// Source is the name of the MessageSource that delivered the message.
+	Source    string
+	Subject   string
+	Sequence  uint64
+	Data      []byte
+	Timestamp time.Time
+	// LastDelivery is set when the broker gives up on the message after
+	// this delivery, so a failure must be dead-lettered rather than nacked.
+	LastDelivery bool
+
+	ack func() error
+	nak func() error
+}
+
+// Ack confirms the message so that it is not delivered again.
+func (m *Message) Ack() error {
+	if m.ack == nil {
+		return nil
+	}
+	return m.ack()
+}
+
+// Nak asks for an early redelivery. Sources without negative acks
+// redeliver after the ack wait instead.
+func (m *Message) Nak() error {
+	if m.nak == nil {
+		return nil
+	}
+	return m.nak()
+}
+
+type Handler func(msg *Message)
+
+// MessageSource is a durable subscription on a broker. Stop and Close keep
+// the durable state on the server, so a restarted service resumes after
+// the last acked message.
+type MessageSource interface {
+	Name() string
+	Connect() error
+	Start(handler Handler) error
+	Stop() error
+	State() string
+	Publish(subject string, data []byte) error
+	Close() error
+}
+
+func recordState(name, state string) {
+	log.Printf("%s connection %s", name, state)
+	metrics.SourceConnectionTransitions.WithLabelValues(name, state).Inc()
+	if state == StateConnected {
+		metrics.SourceConnected.WithLabelValues(name).Set(1)
+	} else {
+		metrics.SourceConnected.WithLabelValues(name).Set(0)
+	}
+}
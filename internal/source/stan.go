@@ -0,0 +1,281 @@
+package source
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/stan.go"
+)
+
+// Server pings detect a dead NATS Streaming server after roughly
+// pingInterval*pingMaxOut seconds and trigger the connection lost handler.
+const (
+	pingInterval = 5
+	pingMaxOut   = 3
+)
+
+type StanConfig struct {
+	// Name tells apart several Stan sources in logs, metrics and message
+	// streams; it defaults to "stan".
+	Name        string
+	ClusterID   string
+	ClientID    string
+	Channel     string
+	DurableName string
+	// QueueGroup, if set, makes the subscription a durable queue
+	// subscription: replicas in the same group share the channel, each
+	// message going to one of them. Its position belongs to the group, not
+	// to ClientID, so client IDs may change between restarts.
+	QueueGroup  string
+	AckWait     time.Duration
+	MaxInflight int
+	// MaxDeliver, if set, makes the MaxDeliver-th delivery of a message its
+	// last one, so that it is dead-lettered rather than redelivered forever.
+	MaxDeliver   int
+	ReconnectMin time.Duration
+	ReconnectMax time.Duration
+}
+
+// Stan consumes a durable NATS Streaming subscription. It survives server
+// restarts: when the connection is lost it reconnects with exponential
+// backoff and recreates the subscription, which resumes from the last
+// acked message.
+type Stan struct {
+	name       string
+	dial       func(lost stan.ConnectionLostHandler) (stan.Conn, error)
+	channel    string
+	queue      string
+	maxDeliver int
+	opts       []stan.SubscriptionOption
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	conn    stan.Conn
+	sub     stan.Subscription
+	handler stan.MsgHandler
+	state   string
+	done    chan struct{}
+}
+
+func NewStan(cfg StanConfig) *Stan {
+	name := cfg.Name
+	if name == "" {
+		name = "stan"
+	}
+	return &Stan{
+		name: name,
+		dial: func(lost stan.ConnectionLostHandler) (stan.Conn, error) {
+			return stan.Connect(cfg.ClusterID, cfg.ClientID,
+				stan.Pings(pingInterval, pingMaxOut),
+				stan.SetConnectionLostHandler(lost))
+		},
+		channel:    cfg.Channel,
+		queue:      cfg.QueueGroup,
+		maxDeliver: cfg.MaxDeliver,
+		opts: []stan.SubscriptionOption{
+			stan.DurableName(cfg.DurableName),
+			stan.SetManualAckMode(),
+			stan.AckWait(cfg.AckWait),
+			stan.MaxInflight(cfg.MaxInflight),
+		},
+		minBackoff: cfg.ReconnectMin,
+		maxBackoff: cfg.ReconnectMax,
+		done:       make(chan struct{}),
+	}
+}
+
+func (s *Stan) Name() string {
+	return s.name
+}
+
+func (s *Stan) Connect() error {
+	if err := s.open(); err != nil {
+		return err
+	}
+	s.setState(StateConnected)
+	return nil
+}
+
+func (s *Stan) open() error {
+	conn, err := s.dial(s.onConnectionLost)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		conn.Close()
+		return errors.New("NATS Streaming source closed")
+	default:
+	}
+	s.conn = conn
+	return nil
+}
+
+// State reports the connection state, checking the underlying NATS
+// connection as well while the client believes it is connected.
+func (s *Stan) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == StateConnected && s.conn != nil {
+		if nc := s.conn.NatsConn(); nc != nil && nc.Status() != nats.CONNECTED {
+			return StateReconnecting
+		}
+	}
+	return s.state
+}
+
+func (s *Stan) setState(state string) {
+	s.mu.Lock()
+	changed := s.state != state
+	s.state = state
+	s.mu.Unlock()
+
+	if changed {
+		recordState(s.Name(), state)
+	}
+}
+
+// Start subscribes and remembers the handler so that the subscription is
+// recreated on every reconnect.
+func (s *Stan) Start(handler Handler) error {
+	s.mu.Lock()
+	s.handler = func(msg *stan.Msg) {
+		handler(&Message{
+			Source:       s.Name(),
+			Subject:      msg.Subject,
+			Sequence:     msg.Sequence,
+			Data:         msg.Data,
+			Timestamp:    time.Unix(0, msg.Timestamp),
+			LastDelivery: s.maxDeliver > 0 && msg.RedeliveryCount+1 >= uint32(s.maxDeliver),
+			ack:          msg.Ack,
+		})
+	}
+	s.mu.Unlock()
+	return s.resubscribe()
+}
+
+func (s *Stan) resubscribe() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.handler == nil {
+		return nil
+	}
+	if s.conn == nil {
+		return errNotConnected
+	}
+
+	var sub stan.Subscription
+	var err error
+	if s.queue != "" {
+		sub, err = s.conn.QueueSubscribe(s.channel, s.queue, s.handler, s.opts...)
+	} else {
+		sub, err = s.conn.Subscribe(s.channel, s.handler, s.opts...)
+	}
+	if err != nil {
+		return err
+	}
+	s.sub = sub
+	return nil
+}
+
+// Stop stops deliveries but keeps the durable on the server.
+func (s *Stan) Stop() error {
+	s.mu.Lock()
+	sub := s.sub
+	s.sub, s.handler = nil, nil
+	s.mu.Unlock()
+
+	if sub == nil {
+		return nil
+	}
+	return sub.Close()
+}
+
+func (s *Stan) onConnectionLost(_ stan.Conn, reason error) {
+	s.mu.Lock()
+	s.conn, s.sub = nil, nil
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	log.Printf("NATS Streaming connection lost: %v", reason)
+	s.setState(StateReconnecting)
+	go s.reconnect()
+}
+
+func (s *Stan) reconnect() {
+	backoff := s.minBackoff
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-s.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		err := s.open()
+		if err == nil {
+			err = s.resubscribe()
+		}
+		if err == nil {
+			s.setState(StateConnected)
+			log.Printf("NATS Streaming reconnected after %d attempts", attempt)
+			return
+		}
+
+		log.Printf("NATS Streaming reconnect attempt %d failed: %v", attempt, err)
+		s.mu.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+		s.mu.Unlock()
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+func (s *Stan) Publish(subject string, data []byte) error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn == nil {
+		return errNotConnected
+	}
+	return conn.Publish(subject, data)
+}
+
+// Close stops reconnecting and closes the connection without removing the
+// durable subscription.
+func (s *Stan) Close() error {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	conn := s.conn
+	s.conn, s.sub = nil, nil
+	s.mu.Unlock()
+
+	s.setState(StateClosed)
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
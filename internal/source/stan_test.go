@@ -0,0 +1,156 @@
+package source
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/stan.go"
+	"github.com/nats-io/stan.go/pb"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConn struct {
+	stan.Conn
+	mu       sync.Mutex
+	channels []string
+	closed   bool
+}
+
+func (f *fakeConn) Subscribe(subject string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.channels = append(f.channels, subject)
+	return &fakeSubscription{}, nil
+}
+
+func (f *fakeConn) QueueSubscribe(subject, qgroup string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	return f.Subscribe(qgroup+":"+subject, cb, opts...)
+}
+
+func (f *fakeConn) NatsConn() *nats.Conn {
+	return nil
+}
+
+func (f *fakeConn) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeConn) subscribed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.channels...)
+}
+
+type fakeSubscription struct {
+	stan.Subscription
+	closed bool
+}
+
+func (f *fakeSubscription) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestStanReconnects(t *testing.T) {
+	var mu sync.Mutex
+	var conns []*fakeConn
+	failures := 2
+
+	src := &Stan{
+		dial: func(lost stan.ConnectionLostHandler) (stan.Conn, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if len(conns) > 0 && failures > 0 {
+				failures--
+				return nil, errors.New("connection refused")
+			}
+			conn := &fakeConn{}
+			conns = append(conns, conn)
+			return conn, nil
+		},
+		channel:    "orders",
+		minBackoff: time.Millisecond,
+		maxBackoff: 4 * time.Millisecond,
+		done:       make(chan struct{}),
+	}
+
+	assert.NoError(t, src.Connect())
+	assert.NoError(t, src.Start(func(*Message) {}))
+	assert.Equal(t, StateConnected, src.State())
+
+	src.onConnectionLost(nil, errors.New("ping timeout"))
+	assert.Equal(t, StateReconnecting, src.State())
+	assert.ErrorIs(t, src.Publish("orders", nil), errNotConnected)
+
+	assert.Eventually(t, func() bool {
+		return src.State() == StateConnected
+	}, time.Second, time.Millisecond)
+
+	mu.Lock()
+	assert.Len(t, conns, 2)
+	assert.Equal(t, []string{"orders"}, conns[0].subscribed())
+	assert.Equal(t, []string{"orders"}, conns[1].subscribed())
+	mu.Unlock()
+
+	assert.NoError(t, src.Stop())
+	assert.NoError(t, src.Close())
+	assert.Equal(t, StateClosed, src.State())
+	assert.True(t, conns[1].closed)
+
+	src.onConnectionLost(nil, errors.New("late notification"))
+	assert.Equal(t, StateClosed, src.State())
+}
+
+func TestStanMessageAck(t *testing.T) {
+	conn := &fakeConn{}
+	src := &Stan{
+		dial: func(stan.ConnectionLostHandler) (stan.Conn, error) {
+			return conn, nil
+		},
+		channel: "orders",
+		done:    make(chan struct{}),
+	}
+	assert.NoError(t, src.Connect())
+
+	var got *Message
+	assert.NoError(t, src.Start(func(msg *Message) { got = msg }))
+
+	src.handler(&stan.Msg{MsgProto: pb.MsgProto{
+		Subject:   "orders",
+		Sequence:  7,
+		Data:      []byte("{}"),
+		Timestamp: time.Unix(100, 0).UnixNano(),
+	}})
+
+	assert.Equal(t, "orders", got.Subject)
+	assert.Equal(t, uint64(7), got.Sequence)
+	assert.Equal(t, []byte("{}"), got.Data)
+	assert.True(t, time.Unix(100, 0).Equal(got.Timestamp))
+	assert.False(t, got.LastDelivery)
+	assert.NoError(t, got.Nak())
+
+	src.maxDeliver = 3
+	src.handler(&stan.Msg{MsgProto: pb.MsgProto{Subject: "orders", Sequence: 7, RedeliveryCount: 1}})
+	assert.False(t, got.LastDelivery)
+	src.handler(&stan.Msg{MsgProto: pb.MsgProto{Subject: "orders", Sequence: 7, RedeliveryCount: 2}})
+	assert.True(t, got.LastDelivery)
+}
+
+func TestStanQueueSubscribe(t *testing.T) {
+	conn := &fakeConn{}
+	src := NewStan(StanConfig{Channel: "orders", QueueGroup: "order-service"})
+	src.dial = func(stan.ConnectionLostHandler) (stan.Conn, error) {
+		return conn, nil
+	}
+	assert.NoError(t, src.Connect())
+	assert.NoError(t, src.Start(func(*Message) {}))
+
+	assert.Equal(t, []string{"order-service:orders"}, conn.subscribed())
+	assert.Equal(t, "stan", src.Name())
+}
@@ -1,5 +1,5 @@
 -- Таблица заказов 
-CREATE TABLE orders (
+CREATE TABLE IF NOT EXISTS orders (
     order_uid VARCHAR(50) PRIMARY KEY,
     track_number VARCHAR(50) NOT NULL,
     entry VARCHAR(10) NOT NULL,
@@ -14,7 +14,7 @@ CREATE TABLE orders (
 );
 
 -- Таблица доставки 
-CREATE TABLE delivery (
+CREATE TABLE IF NOT EXISTS delivery (
     id SERIAL PRIMARY KEY,
     order_uid VARCHAR(50) NOT NULL UNIQUE,
     name VARCHAR(100) NOT NULL,
@@ -28,7 +28,7 @@ CREATE TABLE delivery (
 );
 
 -- Таблица платежей 
-CREATE TABLE payment (
+CREATE TABLE IF NOT EXISTS payment (
     transaction VARCHAR(50) PRIMARY KEY,
     order_uid VARCHAR(50) NOT NULL UNIQUE,
     request_id VARCHAR(50),
@@ -44,7 +44,7 @@ CREATE TABLE payment (
 );
 
 -- Таблица товаров
-CREATE TABLE items (
+CREATE TABLE IF NOT EXISTS items (
     id SERIAL PRIMARY KEY,
     order_uid VARCHAR(50) NOT NULL,
     chrt_id INTEGER NOT NULL,
@@ -0,0 +1,12 @@
+-- Таблица отклоненных сообщений
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    channel VARCHAR(255) NOT NULL,
+    sequence BIGINT NOT NULL,
+    reason TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_received_at ON dead_letters(received_at);
@@ -0,0 +1,2 @@
+-- Сработавшие правила согласованности заказа
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS violations JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,12 @@
+-- Индексы для поиска и постраничного вывода заказов
+CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders(date_created DESC, order_uid DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders(customer_id);
+CREATE INDEX IF NOT EXISTS idx_orders_track_number ON orders(track_number);
+CREATE INDEX IF NOT EXISTS idx_orders_delivery_service ON orders(delivery_service);
+
+CREATE INDEX IF NOT EXISTS idx_payment_provider ON payment(provider);
+CREATE INDEX IF NOT EXISTS idx_payment_currency ON payment(currency);
+
+CREATE INDEX IF NOT EXISTS idx_items_order_uid ON items(order_uid);
+CREATE INDEX IF NOT EXISTS idx_items_brand ON items(brand);
+CREATE INDEX IF NOT EXISTS idx_items_nm_id ON items(nm_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_items_track_number;
+DROP INDEX IF EXISTS idx_items_rid;
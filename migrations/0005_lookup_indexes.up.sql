@@ -0,0 +1,3 @@
+-- Индексы для поиска заказа по трек-номеру товара и rid
+CREATE INDEX IF NOT EXISTS idx_items_track_number ON items(track_number);
+CREATE INDEX IF NOT EXISTS idx_items_rid ON items(rid);
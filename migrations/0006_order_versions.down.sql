@@ -0,0 +1,3 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS payload_hash;
+ALTER TABLE orders DROP COLUMN IF EXISTS source_seq;
+ALTER TABLE orders DROP COLUMN IF EXISTS source_stream;
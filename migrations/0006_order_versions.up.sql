@@ -0,0 +1,4 @@
+-- Позиция и хэш сообщения, из которого сохранена текущая версия заказа
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS source_stream VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS source_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payload_hash VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+-- История версий заказа: каждое сохраненное сообщение и его отличия от предыдущего
+CREATE TABLE IF NOT EXISTS order_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(50) NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
+    source_stream VARCHAR(255) NOT NULL,
+    source_seq BIGINT NOT NULL,
+    payload BYTEA NOT NULL,
+    diff JSONB,
+    received_at TIMESTAMP NOT NULL,
+    recorded_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_history_order_uid ON order_history(order_uid, id);
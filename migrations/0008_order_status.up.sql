@@ -0,0 +1,15 @@
+-- Статус заказа и переходы между статусами
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status VARCHAR(32) NOT NULL DEFAULT 'created';
+
+CREATE TABLE IF NOT EXISTS order_status_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(50) NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
+    from_status VARCHAR(32) NOT NULL,
+    to_status VARCHAR(32) NOT NULL,
+    changed_at TIMESTAMP NOT NULL,
+    source_stream VARCHAR(255) NOT NULL,
+    source_seq BIGINT NOT NULL,
+    recorded_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_transitions_order_uid ON order_status_transitions(order_uid, id);
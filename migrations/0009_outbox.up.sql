@@ -0,0 +1,8 @@
+-- События о сохраненных заказах; пишутся в транзакции сохранения и удаляются после публикации
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    subject VARCHAR(255) NOT NULL,
+    order_uid VARCHAR(50) NOT NULL,
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
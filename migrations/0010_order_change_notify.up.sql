@@ -0,0 +1,19 @@
+-- Оповещение реплик об изменении заказов: каждая реплика слушает канал
+-- order_changes и сбрасывает устаревшие записи своего кэша
+CREATE OR REPLACE FUNCTION notify_order_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('order_changes',
+            json_build_object('op', 'delete', 'order_uid', OLD.order_uid)::text);
+        RETURN OLD;
+    END IF;
+    PERFORM pg_notify('order_changes',
+        json_build_object('op', 'set', 'order_uid', NEW.order_uid, 'payload_hash', NEW.payload_hash)::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS orders_notify_change ON orders;
+CREATE TRIGGER orders_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON orders
+    FOR EACH ROW EXECUTE FUNCTION notify_order_change();
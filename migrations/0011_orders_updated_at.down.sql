@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_orders_updated_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,4 @@
+-- Время последней записи заказа: после загрузки снимка кэша догружаются заказы, измененные позже него
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_orders_updated_at ON orders(updated_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_dead_letters_message;
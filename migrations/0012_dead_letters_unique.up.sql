@@ -0,0 +1,9 @@
+-- Повторная запись того же отклоненного сообщения (например, при повторной доставке после ошибки публикации) не создает дубликат
+DELETE FROM dead_letters a
+USING dead_letters b
+WHERE a.id > b.id
+  AND a.channel = b.channel
+  AND a.sequence = b.sequence
+  AND md5(a.payload) = md5(b.payload);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dead_letters_message ON dead_letters(channel, sequence, md5(payload));
@@ -0,0 +1 @@
+ALTER TABLE orders ALTER COLUMN updated_at TYPE TIMESTAMP;
@@ -0,0 +1,2 @@
+-- updated_at сравнивается со временем снимка кэша, поэтому хранится с часовым поясом и не зависит от TimeZone сессии
+ALTER TABLE orders ALTER COLUMN updated_at TYPE TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+// Package migrations embeds the numbered SQL migrations applied by
+// internal/migrate. Files are named NNNN_name.up.sql and NNNN_name.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS